@@ -0,0 +1,10 @@
+// Package api holds the OpenAPI description of the service. It is embedded so that
+// request payloads can be validated against the same schemas that are published.
+package api
+
+import _ "embed"
+
+// OpenAPI is the contents of openapi.yaml.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
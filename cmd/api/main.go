@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,15 +10,34 @@ import (
 	"time"
 
 	"github.com/KostasDasios/platform-go-challenge/internal/config"
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
 	"github.com/KostasDasios/platform-go-challenge/internal/server"
+	"github.com/KostasDasios/platform-go-challenge/internal/tracing"
 )
 
 func main() {
 	// Load configuration from .env
 	cfg := config.LoadConfig()
 
+	// Structured logger: JSON in production, text otherwise, filtered by LOG_LEVEL.
+	// It also becomes the default so that std log output goes through it.
+	logger := logging.New(os.Stdout, cfg.AppEnv, cfg.LogLevel)
+	slog.SetDefault(logger)
+	logger.Info("config loaded", "config", cfg)
+
+	// Tracing: spans for the middleware chain, handlers, service and repository
+	shutdownTracing, err := tracing.Setup(cfg.TracingExporter, cfg.TracingFile)
+	if err != nil {
+		logger.Error("tracing init failed", "err", err)
+		os.Exit(1)
+	}
+
 	// Build server using internal layers
-	s := server.NewServer(cfg)
+	s, err := server.NewServer(cfg, logger)
+	if err != nil {
+		logger.Error("server init failed", "err", err)
+		os.Exit(1)
+	}
 
 	// Configure HTTP server with proper timeouts
 	srv := &http.Server{
@@ -31,9 +50,23 @@ func main() {
 
 	// Start server in background goroutine
 	go func() {
-		log.Printf("[INFO] Server listening on :%s (env: %s)\n", cfg.Port, cfg.AppEnv)
+		logger.Info("server listening", "port", cfg.Port, "env", cfg.AppEnv)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("[ERROR] Server failed: %v", err)
+			logger.Error("server failed", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	// SIGHUP reloads the API key registry so keys can be rotated without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := s.ReloadKeys(); err != nil {
+				logger.Error("reloading API keys failed, keeping the previous set", "err", err)
+			} else {
+				logger.Info("API keys reloaded")
+			}
 		}
 	}()
 
@@ -41,17 +74,27 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	sig := <-quit
-	log.Printf("[INFO] Caught signal: %v, initiating graceful shutdown...", sig)
+	logger.Info("caught signal, initiating graceful shutdown", "signal", sig.String())
 
 	// Gracefully shut down server with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("[ERROR] Graceful shutdown failed: %v", err)
+		logger.Error("graceful shutdown failed", "err", err)
 	} else {
-		log.Println("[INFO] Server shut down cleanly.")
+		logger.Info("server shut down cleanly")
+	}
+
+	// Flush storage only after in-flight requests have drained
+	if err := s.Close(); err != nil {
+		logger.Error("closing storage failed", "err", err)
+	}
+
+	// Flush spans last so that shutdown work is still exported
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("flushing traces failed", "err", err)
 	}
 
-	log.Println("[INFO] Server exiting")
+	logger.Info("server exiting")
 }
@@ -0,0 +1,19 @@
+package assets
+
+import (
+	"github.com/KostasDasios/platform-go-challenge/api"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/schema"
+)
+
+// specSchemas are the component schemas of the published OpenAPI description; the
+// built-in types take their schemas from it, so the spec and the validation agree.
+var specSchemas = schema.MustLoad(api.OpenAPI)
+
+func init() {
+	Default.MustRegister(Of(models.AssetChart, specSchemas.Schema("Chart"), nil,
+		func(c models.Chart) string { return c.Title }))
+	Default.MustRegister(Of(models.AssetInsight, specSchemas.Schema("Insight"), nil,
+		func(in models.Insight) string { return in.Text }))
+	Default.MustRegister(Of[models.Audience](models.AssetAudience, specSchemas.Schema("Audience"), nil, nil))
+}
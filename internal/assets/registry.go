@@ -0,0 +1,121 @@
+// Package assets is the registry of asset types a favourite can wrap. Each type brings
+// its own schema, decoder, validation rules and search text, so a new kind of asset is
+// added by registering it (typically from an init function) rather than by changing
+// the service.
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/schema"
+)
+
+// Type describes one kind of asset.
+type Type struct {
+	// Name is the value of the payload's "type" property that selects this type.
+	Name models.AssetType
+	// Schema is the JSON Schema every payload of this type must satisfy.
+	Schema *schema.Schema
+	// Decode turns a payload that satisfies Schema into the type's model.
+	Decode func(raw json.RawMessage) (any, error)
+	// Validate, if set, checks rules the schema cannot express on the decoded model.
+	// Fields are relative to the asset, e.g. "data.0".
+	Validate func(v any) []schema.Violation
+	// SearchText, if set, returns the text list search matches for the decoded model.
+	SearchText func(v any) string
+}
+
+// Of builds a Type whose payloads decode into the model T with encoding/json.
+// validate and searchText receive the decoded T; either may be nil.
+func Of[T any](name models.AssetType, sch *schema.Schema, validate func(T) []schema.Violation, searchText func(T) string) Type {
+	t := Type{
+		Name:   name,
+		Schema: sch,
+		Decode: func(raw json.RawMessage) (any, error) {
+			var v T
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	}
+	if validate != nil {
+		t.Validate = func(v any) []schema.Violation { return validate(v.(T)) }
+	}
+	if searchText != nil {
+		t.SearchText = func(v any) string { return searchText(v.(T)) }
+	}
+	return t
+}
+
+// Registry maps asset type names to their Type. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[models.AssetType]*Type
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry { return &Registry{types: map[models.AssetType]*Type{}} }
+
+// Default holds the built-in types (chart, insight, audience) and any type added with
+// Register. The service validates assets against it.
+var Default = NewRegistry()
+
+// Register adds t to the Default registry.
+func Register(t Type) error { return Default.Register(t) }
+
+// Register adds t. Name, Schema and Decode are required and a name can only be registered once.
+func (r *Registry) Register(t Type) error {
+	switch {
+	case strings.TrimSpace(string(t.Name)) == "":
+		return errors.New("asset type needs a name")
+	case t.Schema == nil:
+		return fmt.Errorf("asset type %q needs a schema", t.Name)
+	case t.Decode == nil:
+		return fmt.Errorf("asset type %q needs a decoder", t.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.types[t.Name]; dup {
+		return fmt.Errorf("asset type %q is already registered", t.Name)
+	}
+	r.types[t.Name] = &t
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (r *Registry) MustRegister(t Type) {
+	if err := r.Register(t); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the type registered under name.
+func (r *Registry) Lookup(name models.AssetType) (*Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// Known reports whether name is a registered type.
+func (r *Registry) Known(name models.AssetType) bool {
+	_, ok := r.Lookup(name)
+	return ok
+}
+
+// Names returns the registered type names in alphabetical order.
+func (r *Registry) Names() []models.AssetType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]models.AssetType, 0, len(r.types))
+	for n := range r.types {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
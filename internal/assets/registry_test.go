@@ -0,0 +1,84 @@
+package assets
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/schema"
+)
+
+type report struct {
+	Name  string `json:"name"`
+	Pages int    `json:"pages"`
+}
+
+var reportSchema = schema.MustCompile([]byte(`{
+	"type": "object",
+	"properties": {"type": {"const": "report"}, "name": {"type": "string"}, "pages": {"type": "integer"}},
+	"required": ["type", "name"]
+}`))
+
+// TestRegistry checks registration rules and that a type built with Of decodes,
+// validates and extracts search text through its model.
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	rep := Of("report", reportSchema,
+		func(v report) []schema.Violation {
+			if v.Pages > 100 {
+				return []schema.Violation{{Field: "pages", Reason: "must be at most 100"}}
+			}
+			return nil
+		},
+		func(v report) string { return v.Name })
+	if err := r.Register(rep); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	for name, bad := range map[string]Type{
+		"duplicate":  rep,
+		"no name":    {Schema: reportSchema, Decode: rep.Decode},
+		"no schema":  {Name: "x", Decode: rep.Decode},
+		"no decoder": {Name: "x", Schema: reportSchema},
+	} {
+		if err := r.Register(bad); err == nil {
+			t.Errorf("%s: registered", name)
+		}
+	}
+
+	typ, ok := r.Lookup("report")
+	if !ok || !r.Known("report") || r.Known("chart") {
+		t.Fatalf("lookup failed")
+	}
+	v, err := typ.Decode(json.RawMessage(`{"type":"report","name":"Q3","pages":250}`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := typ.SearchText(v); got != "Q3" {
+		t.Fatalf("SearchText = %q", got)
+	}
+	if got := typ.Validate(v); len(got) != 1 || got[0].Field != "pages" {
+		t.Fatalf("Validate = %+v", got)
+	}
+}
+
+// TestDefault_MatchesSpec checks that the built-in types are registered and that the
+// OpenAPI Asset discriminator documents exactly the registered types.
+func TestDefault_MatchesSpec(t *testing.T) {
+	want := []models.AssetType{models.AssetAudience, models.AssetChart, models.AssetInsight}
+	if got := Default.Names(); !slices.Equal(got, want) {
+		t.Fatalf("Default.Names() = %v, want %v", got, want)
+	}
+	d, ok := specSchemas.Discriminator("Asset")
+	if !ok {
+		t.Fatalf("spec has no Asset discriminator")
+	}
+	var documented []models.AssetType
+	for name := range d.Mapping {
+		documented = append(documented, models.AssetType(name))
+	}
+	slices.Sort(documented)
+	if !slices.Equal(documented, want) {
+		t.Fatalf("spec documents %v, registry has %v", documented, want)
+	}
+}
@@ -2,52 +2,114 @@ package config
 
 import (
 	"log"
+	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
 )
 
 // Config holds all runtime configuration loaded from environment variables.
 // Each field has sensible defaults to make local development frictionless.
 type Config struct {
 	// API settings
-	Port         string // Port to bind the HTTP server on
-	AppEnv       string // Environment mode (development, production)
+	Port   string // Port to bind the HTTP server on
+	AppEnv string // Environment mode (development, production)
 
 	// Middleware & limits
-	LogEnabled      bool          // Enable HTTP request logging
-	RateLimitMillis int           // Minimum interval between requests (per user/IP)
-	MaxBodyBytes    int64         // Maximum allowed request body size (bytes)
-	APIKey          string        // Optional shared API key for simple auth (empty disables auth)
+	LogEnabled          bool          // Enable HTTP request logging
+	RateLimitReadRPS    float64       // Sustained GET/HEAD requests per second per user/IP (0 disables)
+	RateLimitReadBurst  int           // Read requests allowed back-to-back before the rate applies
+	RateLimitWriteRPS   float64       // Sustained mutating requests per second per user/IP (0 disables)
+	RateLimitWriteBurst int           // Write requests allowed back-to-back before the rate applies
+	RateLimitBackend    string        // Limiter state: "memory" (per process, default) or "redis" (shared by replicas)
+	RedisURL            string        // Redis server for the redis rate limit backend
+	MaxBodyBytes        int64         // Maximum allowed request body size (bytes)
+	APIKeysFile         string        // API key registry (JSON); empty disables API key auth
+	APIKey              string        // Deprecated: single shared key, used only when APIKeysFile is empty
+	IdempotencyTTL      time.Duration // How long Idempotency-Key responses are replayed (0 disables)
+
+	// JWT bearer auth on /users/{userID} routes (enabled when a secret or JWKS file is set)
+	JWTSecret     string // HS256 shared secret
+	JWTJWKSFile   string // local JWKS file with RS256 public keys
+	JWTIssuer     string // required "iss" claim (optional)
+	JWTAudience   string // required "aud" claim (optional)
+	JWTAdminScope string // scope allowed to act on behalf of any user
+
+	// Storage
+	StorageBackend string // Repository implementation: "memory" (default), "file" or "sqlite"
+	DataDir        string // Directory for the write-ahead log and snapshots (file backend)
+	SnapshotEvery  int    // Compact the log into a snapshot after this many records (0 disables)
+	SQLitePath     string // Database file (sqlite backend)
 
 	// Timeouts
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 
-	// Log level placeholder for future structured logging
+	// Minimum log level: debug, info, warn or error
 	LogLevel string
+
+	// OpenTelemetry tracing
+	TracingExporter string // "none" (default), "stdout" or "file"
+	TracingFile     string // Span output file (file exporter)
 }
 
 // LoadConfig reads environment variables, applies defaults and returns a populated Config struct.
 // It uses helper functions to handle type conversion and default values gracefully.
 func LoadConfig() *Config {
 	cfg := &Config{
-		Port:            getEnv("APP_PORT", "8080"),
-		AppEnv:          getEnv("APP_ENV", "development"),
-		LogEnabled:      getEnvBool("ENABLE_HTTP_LOG", true),
-		RateLimitMillis: getEnvInt("RATE_LIMIT_MS", 50),
-		MaxBodyBytes:    getEnvInt64("MAX_BODY_BYTES", 1<<20), // 1MB default
-		ReadTimeout:     getEnvDurationSec("READ_TIMEOUT", 5),
-		WriteTimeout:    getEnvDurationSec("WRITE_TIMEOUT", 10),
-		IdleTimeout:     getEnvDurationSec("IDLE_TIMEOUT", 60),
-		LogLevel:        getEnv("LOG_LEVEL", "info"),
-		APIKey:          getEnv("API_KEY", ""), // empty -> auth disabled
+		Port:                getEnv("APP_PORT", "8080"),
+		AppEnv:              getEnv("APP_ENV", "development"),
+		LogEnabled:          getEnvBool("ENABLE_HTTP_LOG", true),
+		RateLimitReadRPS:    getEnvFloat("RATE_LIMIT_READ_RPS", 20),
+		RateLimitReadBurst:  getEnvInt("RATE_LIMIT_READ_BURST", 40),
+		RateLimitWriteRPS:   getEnvFloat("RATE_LIMIT_WRITE_RPS", 5),
+		RateLimitWriteBurst: getEnvInt("RATE_LIMIT_WRITE_BURST", 10),
+		RateLimitBackend:    getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RedisURL:            getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		MaxBodyBytes:        getEnvInt64("MAX_BODY_BYTES", 1<<20), // 1MB default
+		IdempotencyTTL:      getEnvDurationSec("IDEMPOTENCY_TTL", 24*60*60),
+		StorageBackend:      getEnv("STORAGE_BACKEND", "memory"),
+		DataDir:             getEnv("DATA_DIR", "./data"),
+		SnapshotEvery:       getEnvInt("SNAPSHOT_EVERY", 1000),
+		SQLitePath:          getEnv("SQLITE_PATH", "./data/favourites.db"),
+		ReadTimeout:         getEnvDurationSec("READ_TIMEOUT", 5),
+		WriteTimeout:        getEnvDurationSec("WRITE_TIMEOUT", 10),
+		IdleTimeout:         getEnvDurationSec("IDLE_TIMEOUT", 60),
+		LogLevel:            getEnv("LOG_LEVEL", "info"),
+		TracingExporter:     getEnv("TRACING_EXPORTER", "none"),
+		TracingFile:         getEnv("TRACING_FILE", "./data/traces.jsonl"),
+		APIKeysFile:         getEnv("API_KEYS_FILE", ""),
+		APIKey:              getEnv("API_KEY", ""), // empty -> auth disabled
+		JWTSecret:           getEnv("JWT_HS256_SECRET", ""),
+		JWTJWKSFile:         getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:           getEnv("JWT_ISSUER", ""),
+		JWTAudience:         getEnv("JWT_AUDIENCE", ""),
+		JWTAdminScope:       getEnv("JWT_ADMIN_SCOPE", "admin"),
 	}
-	log.Printf("Config loaded: %+v", cfg)
 	return cfg
 }
 
+// LogValue implements slog.LogValuer so that logging a Config never prints credentials.
+func (c *Config) LogValue() slog.Value {
+	safe := *c
+	for _, secret := range []*string{&safe.APIKey, &safe.JWTSecret} {
+		if *secret != "" {
+			*secret = logging.Redacted
+		}
+	}
+	if u, err := url.Parse(safe.RedisURL); err == nil {
+		safe.RedisURL = u.Redacted()
+	}
+	return slog.AnyValue(safe)
+}
+
+// JWTEnabled reports whether bearer-token authentication is configured.
+func (c *Config) JWTEnabled() bool { return c.JWTSecret != "" || c.JWTJWKSFile != "" }
+
 // --- helpers ---
 
 func getEnv(key, def string) string {
@@ -79,6 +141,16 @@ func getEnvInt(key string, def int) int {
 	return def
 }
 
+func getEnvFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		log.Printf("invalid float for %s=%s, using default %g", key, v, def)
+	}
+	return def
+}
+
 func getEnvInt64(key string, def int64) int64 {
 	if v := os.Getenv(key); v != "" {
 		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
@@ -0,0 +1,148 @@
+// Package metrics collects the Prometheus metrics exposed on /metrics.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/assets"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// Metrics owns a private registry, so several servers (e.g. in tests) can coexist in
+// one process. All recording methods are safe on a nil *Metrics and do nothing.
+type Metrics struct {
+	reg         *prometheus.Registry
+	requests    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	rateLimited *prometheus.CounterVec
+	failOpen    *prometheus.CounterVec
+	invalid     *prometheus.CounterVec
+	types       *assets.Registry
+}
+
+// New registers the HTTP, rate limiter and validation metrics, the Go runtime and
+// process collectors and, on every scrape, the per-type favourite counts of r. Asset
+// type labels are limited to the types registered in types, the registry the service
+// validates with.
+func New(r repo.Repository, types *assets.Registry) *Metrics {
+	m := &Metrics{
+		reg:   prometheus.NewRegistry(),
+		types: types,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route template, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limit_rejections_total",
+			Help: "Requests refused with 429 by the rate limiter, by budget (read or write).",
+		}, []string{"class"}),
+		failOpen: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limit_fail_open_total",
+			Help: "Requests let through unchecked because the rate limiter store failed, by budget (read or write).",
+		}, []string{"class"}),
+		invalid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "asset_validation_failures_total",
+			Help: "Asset payloads rejected by validation, by asset type (unknown when the type itself is invalid).",
+		}, []string{"asset_type"}),
+	}
+	m.reg.MustRegister(
+		m.requests, m.duration, m.rateLimited, m.failOpen, m.invalid,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&storedCollector{repo: r, types: types, desc: prometheus.NewDesc(
+			"favourites_stored", "Favourites currently stored, by asset type, as reported by the repository.",
+			[]string{"asset_type"}, nil,
+		)},
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records one completed HTTP request. route must be a template
+// (e.g. /users/{userID}/favourites) so that label values stay bounded.
+func (m *Metrics) ObserveRequest(route, method string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.duration.WithLabelValues(route, method, code).Observe(d.Seconds())
+}
+
+// RateLimited records a request refused by the rate limiter.
+func (m *Metrics) RateLimited(class string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(class).Inc()
+}
+
+// RateLimitFailedOpen records a request let through because the rate limiter store failed.
+func (m *Metrics) RateLimitFailedOpen(class string) {
+	if m == nil {
+		return
+	}
+	m.failOpen.WithLabelValues(class).Inc()
+}
+
+// ValidationFailed records a rejected asset payload. Types not in the registry given to
+// New are reported as "unknown" so that clients cannot create arbitrary label values.
+func (m *Metrics) ValidationFailed(t models.AssetType) {
+	if m == nil {
+		return
+	}
+	label := "unknown"
+	if m.types.Known(t) {
+		label = string(t)
+	}
+	m.invalid.WithLabelValues(label).Inc()
+}
+
+// scrapeTimeout bounds the repository query made for each scrape.
+const scrapeTimeout = 5 * time.Second
+
+// storedCollector asks the repository for its per-type counts at scrape time, so the
+// gauge is always consistent with storage (including writes by other replicas).
+type storedCollector struct {
+	repo  repo.Repository
+	types *assets.Registry
+	desc  *prometheus.Desc
+}
+
+func (c *storedCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+func (c *storedCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	counts, err := c.repo.CountByType(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	// report registered types even when empty so their series do not disappear
+	for _, t := range c.types.Names() {
+		if _, ok := counts[t]; !ok {
+			counts[t] = 0
+		}
+	}
+	for t, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), string(t))
+	}
+}
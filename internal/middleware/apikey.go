@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// API key scopes. Read covers safe methods (GET, HEAD, OPTIONS), write covers
+// mutations, and admin implies both.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var (
+	errUnknownKey = errors.New("unknown api key")
+	errExpiredKey = errors.New("api key expired")
+)
+
+// APIKey is one entry of the key registry. Only the SHA-256 hash of the secret is kept.
+type APIKey struct {
+	Name      string
+	Hash      [sha256.Size]byte
+	Scopes    []string
+	ExpiresAt time.Time // zero means the key never expires
+}
+
+// Allows reports whether the key grants scope; admin grants every scope.
+func (k *APIKey) Allows(scope string) bool {
+	return slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope)
+}
+
+// HashAPIKey returns the registry hash of a raw key: lower-case hex SHA-256.
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyRegistry holds the API keys accepted by APIKeyAuth. Several keys may be active
+// at once, so a key is rotated by adding its successor, moving clients over and then
+// removing (or expiring) the old one. A file-backed registry can be reloaded at runtime.
+type KeyRegistry struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]*APIKey
+}
+
+// NewKeyRegistry builds an in-memory registry from keys; Reload is a no-op on it.
+func NewKeyRegistry(keys []APIKey) (*KeyRegistry, error) {
+	kr := &KeyRegistry{now: time.Now}
+	if err := kr.set(keys); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// LoadKeyRegistry reads a registry file of the form
+//
+//	{"keys": [{"name": "importer", "sha256": "<hex>", "scopes": ["read", "write"], "expires_at": "2026-01-01T00:00:00Z"}]}
+//
+// where sha256 is HashAPIKey of the secret and expires_at is optional.
+func LoadKeyRegistry(path string) (*KeyRegistry, error) {
+	kr := &KeyRegistry{path: path, now: time.Now}
+	if err := kr.Reload(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// Reload re-reads the registry file. On error the previously loaded keys stay active.
+func (kr *KeyRegistry) Reload() error {
+	if kr.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(kr.path)
+	if err != nil {
+		return fmt.Errorf("read api keys: %w", err)
+	}
+	var file struct {
+		Keys []struct {
+			Name      string     `json:"name"`
+			SHA256    string     `json:"sha256"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("parse api keys: %w", err)
+	}
+	keys := make([]APIKey, len(file.Keys))
+	for i, k := range file.Keys {
+		h, err := hex.DecodeString(k.SHA256)
+		if err != nil || len(h) != sha256.Size {
+			return fmt.Errorf("api key %q: sha256 must be 64 hex characters", k.Name)
+		}
+		keys[i] = APIKey{Name: k.Name, Hash: [sha256.Size]byte(h), Scopes: k.Scopes}
+		if k.ExpiresAt != nil {
+			keys[i].ExpiresAt = *k.ExpiresAt
+		}
+	}
+	return kr.set(keys)
+}
+
+// set validates keys and swaps them in.
+func (kr *KeyRegistry) set(keys []APIKey) error {
+	m := make(map[[sha256.Size]byte]*APIKey, len(keys))
+	names := make(map[string]bool, len(keys))
+	for i := range keys {
+		k := &keys[i]
+		if k.Name == "" || names[k.Name] {
+			return fmt.Errorf("api key names must be non-empty and unique (got %q)", k.Name)
+		}
+		if len(k.Scopes) == 0 {
+			return fmt.Errorf("api key %q: no scopes", k.Name)
+		}
+		for _, s := range k.Scopes {
+			if s != ScopeRead && s != ScopeWrite && s != ScopeAdmin {
+				return fmt.Errorf("api key %q: unknown scope %q", k.Name, s)
+			}
+		}
+		if _, dup := m[k.Hash]; dup {
+			return fmt.Errorf("api key %q: duplicate hash", k.Name)
+		}
+		names[k.Name] = true
+		m[k.Hash] = k
+	}
+	kr.mu.Lock()
+	kr.keys = m
+	kr.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the active key matching the raw secret. Keys are found by the hash
+// of the presented value, so the secrets themselves are never stored or compared.
+func (kr *KeyRegistry) Lookup(raw string) (*APIKey, error) {
+	if raw == "" {
+		return nil, errUnknownKey
+	}
+	kr.mu.RLock()
+	k, ok := kr.keys[sha256.Sum256([]byte(raw))]
+	kr.mu.RUnlock()
+	if !ok {
+		return nil, errUnknownKey
+	}
+	if !k.ExpiresAt.IsZero() && !kr.now().Before(k.ExpiresAt) {
+		return nil, errExpiredKey
+	}
+	return k, nil
+}
+
+type apiKeyNameKey struct{}
+
+// APIKeyName returns the name of the API key that authenticated the request, if any.
+func APIKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+// requestScope is the scope a request needs: requiredScope of its method, except that
+// changing the shared asset catalog is reserved to admin keys.
+func requestScope(r *http.Request) string {
+	s := requiredScope(r.Method)
+	if s == ScopeWrite && isCatalogPath(r.URL.Path) {
+		return ScopeAdmin
+	}
+	return s
+}
+
+// requiredScope maps a request method to the scope it needs.
+func requiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// APIKeyAuth authenticates requests by the X-API-Key header against the registry and
+// checks the key's scopes against the request method. The key name is attached to the
+// request context and reported by Logger. A nil registry disables the check.
+func APIKeyAuth(reg *KeyRegistry, next http.Handler) http.Handler {
+	if reg == nil {
+		return next // auth off
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := reg.Lookup(r.Header.Get("X-API-Key"))
+		if err != nil {
+			code, msg := CodeUnauthorized, "missing or unknown API key"
+			if errors.Is(err, errExpiredKey) {
+				code, msg = CodeKeyExpired, err.Error()
+			}
+			WriteError(w, r, http.StatusUnauthorized, code, msg)
+			return
+		}
+		if ri := requestInfoFrom(r.Context()); ri != nil {
+			ri.apiKey = key.Name
+		}
+		if scope := requestScope(r); !key.Allows(scope) {
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "API key lacks the "+scope+" scope for "+r.Method)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyNameKey{}, key.Name)))
+	})
+}
@@ -32,9 +32,10 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 			if allow {
 				w.Header().Set("Access-Control-Allow-Origin", origin) // or "*" if you used wildcard
 				w.Header().Set("Vary", "Origin")
-				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PATCH,DELETE,OPTIONS")
-				// allow headers we use: Content-Type, X-API-Key, and common fetch headers
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, Accept, Authorization")
+				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
+				// allow headers we use: Content-Type, X-API-Key, conditional request headers, and common fetch headers
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, Accept, Authorization, If-Match, If-None-Match, If-Modified-Since, Idempotency-Key, traceparent, tracestate")
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Idempotent-Replayed, RateLimit-Limit, RateLimit-Remaining, Retry-After")
 				// If you need cookies, also set: w.Header().Set("Access-Control-Allow-Credentials","true")
 			}
 
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig selects the keys and claims accepted by JWTAuth. At least one of
+// HS256Secret and JWKSFile must be set.
+type JWTConfig struct {
+	HS256Secret string // shared secret for HS256 tokens
+	JWKSFile    string // local JSON Web Key Set with the RSA public keys for RS256 tokens
+	Issuer      string // required "iss" when non-empty
+	Audience    string // required "aud" when non-empty
+	AdminScope  string // scope that may act on behalf of any user
+}
+
+// Claims are the JWT claims the API relies on. Scope is the space-separated
+// OAuth 2.0 "scope" claim.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+}
+
+// HasScope reports whether the token was granted scope s.
+func (c *Claims) HasScope(s string) bool {
+	return s != "" && slices.Contains(strings.Fields(c.Scope), s)
+}
+
+// JWTVerifier validates bearer tokens signed with HS256 or with an RS256 key from a JWKS file.
+type JWTVerifier struct {
+	secret     []byte
+	keys       map[string]*rsa.PublicKey // kid -> key
+	parser     *jwt.Parser
+	adminScope string
+}
+
+// NewJWTVerifier loads the configured keys. The JWKS file is read once at startup.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{secret: []byte(cfg.HS256Secret), adminScope: cfg.AdminScope}
+	var methods []string
+	if cfg.HS256Secret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("jwt: neither an HS256 secret nor a JWKS file is configured")
+	}
+	// Pinning the accepted algorithms rules out "none" and HS/RS key confusion.
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// Verify checks the token's signature and registered claims and returns its claims.
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// key picks the verification key for a token from its header.
+func (v *JWTVerifier) key(t *jwt.Token) (any, error) {
+	if t.Method == jwt.SigningMethodHS256 {
+		return v.secret, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// LoadJWKS reads the RSA signing keys of a JSON Web Key Set (RFC 7517) from path.
+// Keys of other types or uses are skipped.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwks key %q: invalid exponent", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no RSA signing keys found")
+	}
+	return keys, nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the verified claims JWTAuth attached to the request context.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
+
+// JWTAuth requires a valid "Authorization: Bearer <token>" on /users/{userID}/... and
+// /assets routes. On user routes the token's subject must equal the path userID unless
+// it carries the admin scope; the shared asset catalog can be read with any valid token
+// but only changed with the admin scope. Other routes (health probes) pass through.
+// A nil verifier disables the check.
+func JWTAuth(v *JWTVerifier, next http.Handler) http.Handler {
+	if v == nil {
+		return next // auth off
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := parseUserFromPath(r.URL.Path)
+		catalog := isCatalogPath(r.URL.Path)
+		if userID == "" && !catalog {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "bearer token required")
+			return
+		}
+		claims, err := v.Verify(strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "invalid bearer token")
+			return
+		}
+		admin := claims.HasScope(v.adminScope)
+		switch {
+		case catalog && requiredScope(r.Method) != ScopeRead && !admin:
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "token does not grant write access to the asset catalog")
+			return
+		case !catalog && claims.Subject != userID && !admin:
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "token does not grant access to this user")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
@@ -1,14 +1,14 @@
 package middleware
 
 import (
-	"log"
-	"math/rand"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
+	"github.com/KostasDasios/platform-go-challenge/internal/metrics"
 )
 
 // SecurityHeaders injects common HTTP headers that harden the API surface
@@ -35,13 +35,17 @@ func MaxBody(n int64, next http.Handler) http.Handler {
 	})
 }
 
-// RequestID attaches a unique request identifier to every HTTP response.
-// It helps correlate logs across distributed systems or concurrent requests.
-func RequestID(next http.Handler) http.Handler {
+// Deadline bounds the request context by d so that storage work is cancelled once the
+// server's WriteTimeout would discard the response anyway. A zero d leaves the context as is.
+// Client disconnects already cancel r.Context(); this adds the server-side upper bound.
+func Deadline(d time.Duration, next http.Handler) http.Handler {
+	if d <= 0 {
+		return next
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.Itoa(rand.Intn(999999))
-		w.Header().Set("X-Request-ID", id)
-		next.ServeHTTP(w, r)
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -67,64 +71,83 @@ func (sr *statusRecorder) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// Logger provides basic structured access logging with latency metrics.
-// It can be disabled by setting ENABLE_HTTP_LOG=false in the environment.
-// Example log line:
-//   method=GET path=/users/kostas/favourites status=200 bytes=512 dur=3.1ms ua="curl/7.77" req_id=abc123
-func Logger(next http.Handler) http.Handler {
-	enabled := os.Getenv("ENABLE_HTTP_LOG")
-	if strings.ToLower(enabled) == "false" {
-		return next // logs disabled
-	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		sr := &statusRecorder{ResponseWriter: w}
-		next.ServeHTTP(sr, r)
-
-		reqID := w.Header().Get("X-Request-ID")
-		ua := r.UserAgent()
-		duration := time.Since(start)
-
-		log.Printf(
-			`method=%s path=%s status=%d bytes=%d dur=%s ua="%s" req_id=%s`,
-			r.Method, r.URL.Path, sr.status, sr.bytes, duration, ua, reqID,
-		)
-	})
+// requestInfo collects facts established further down the chain (e.g. by auth)
+// so that Logger, which wraps them, can report them once the request completes.
+type requestInfo struct {
+	apiKey string
 }
 
-// RateLimiter implements a simple per-IP or per-user token bucket
-// with a minimum interval between requests. It is meant as a lightweight
-// protection against abuse or accidental floods, not a full quota system.
-type RateLimiter struct {
-	mu   sync.Mutex
-	last map[string]time.Time
-	rate time.Duration // minimum duration between allowed requests
-}
+type requestInfoKey struct{}
 
-// NewRateLimiter constructs a new limiter enforcing one request every minInterval.
-func NewRateLimiter(minInterval time.Duration) *RateLimiter {
-	return &RateLimiter{last: make(map[string]time.Time), rate: minInterval}
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	ri, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return ri
 }
 
-// Middleware wraps the handler and enforces the rate limit policy.
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+// LogContext attaches the request ID (set by RequestID) and the user ID from the path
+// to the request context, so that every log line written while serving the request
+// carries them, whichever layer writes it.
+func LogContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := r.RemoteAddr
+		attrs := []slog.Attr{slog.String("request_id", RequestIDFromContext(r.Context()))}
 		if u := parseUserFromPath(r.URL.Path); u != "" {
-			key = "user:" + u
+			attrs = append(attrs, slog.String("user_id", u))
 		}
-		now := time.Now()
+		next.ServeHTTP(w, r.WithContext(logging.With(r.Context(), attrs...)))
+	})
+}
 
-		rl.mu.Lock()
-		if t, ok := rl.last[key]; ok && now.Sub(t) < rl.rate {
-			rl.mu.Unlock()
-			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
-			return
+// Logger writes one access log line per request to l, at error level for 5xx responses.
+// A nil l disables access logging (ENABLE_HTTP_LOG=false). Example line (text format):
+//   level=INFO msg=request method=GET path=/users/kostas/favourites status=200 bytes=512 dur=3.1ms ua=curl/7.77 key_name=importer request_id=abc123 user_id=kostas
+func Logger(l *slog.Logger, next http.Handler) http.Handler {
+	if l == nil {
+		return next // logs disabled
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		ri := &requestInfo{}
+		next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, ri)))
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if sr.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sr.status),
+			slog.Int("bytes", sr.bytes),
+			slog.Duration("dur", time.Since(start)),
+			slog.String("ua", r.UserAgent()),
 		}
-		rl.last[key] = now
-		rl.mu.Unlock()
+		// the key's registry name, never the secret itself
+		if ri.apiKey != "" {
+			attrs = append(attrs, slog.String("key_name", ri.apiKey))
+		}
+		l.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
 
-		next.ServeHTTP(w, r)
+// Metrics records every request in m under the route template returned by route, so
+// that user and favourite IDs never become label values. It wraps the whole chain so
+// that rejections (401, 429, ...) are counted too. A nil m disables it.
+func Metrics(m *metrics.Metrics, route func(*http.Request) string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		m.ObserveRequest(route(r), r.Method, sr.status, time.Since(start))
 	})
 }
 
@@ -137,19 +160,9 @@ func parseUserFromPath(p string) string {
 	return ""
 }
 
-// APIKeyAuth enforces a simple shared-secret authentication via the X-API-Key header.
-// If requiredKey is empty, the middleware is a no-op (auth disabled).
-// This is intentionally lightweight for the challenge scope, and can be replaced by JWT or OAuth later.
-func APIKeyAuth(requiredKey string, next http.Handler) http.Handler {
-	if strings.TrimSpace(requiredKey) == "" {
-		return next // auth off
-	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("X-API-Key") != requiredKey {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// isCatalogPath reports whether p addresses the shared asset catalog (/assets[/{assetID}]).
+func isCatalogPath(p string) bool {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	return parts[0] == "assets" && len(parts) <= 2
 }
 
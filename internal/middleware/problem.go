@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemTypePrefix prefixes the stable error code to form a problem's type URI.
+const ProblemTypePrefix = "urn:favourites-api:problem:"
+
+// Stable error codes set by the middleware. Clients should branch on the code (or the
+// type URI built from it), never on the human-readable detail.
+const (
+	CodeUnauthorized = "unauthorized"
+	CodeKeyExpired   = "api_key_expired"
+	CodeForbidden    = "forbidden"
+	CodeRateLimited  = "rate_limited"
+)
+
+// Problem is an RFC 9457 problem details body, extended with a stable error code,
+// the request ID, for validation failures one entry per invalid field and, when a
+// resource already exists, its ID.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Errors     []ProblemField `json:"errors,omitempty"`
+	ExistingID string         `json:"existing_id,omitempty"`
+}
+
+// ProblemField describes one invalid field of a request, e.g. {"field": "asset.title", "reason": "is required"}.
+type ProblemField struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// WriteProblem fills in the type, title, instance and request ID of p and writes it as
+// application/problem+json. Every error response carries the request ID so that a
+// failure reported by a client can be found in the logs and traces.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Type = ProblemTypePrefix + p.Code
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = RequestIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// WriteError writes a problem with the given status, code and detail.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
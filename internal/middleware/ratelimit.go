@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit is a token-bucket policy: a bucket holds up to Burst tokens and refills at
+// Rate tokens per second; every request takes one. A Rate <= 0 disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// enabled reports whether the policy limits anything.
+func (l Limit) enabled() bool { return l.Rate > 0 }
+
+// burst is the bucket capacity; at least one token so that requests can ever pass.
+func (l Limit) burst() float64 { return float64(max(l.Burst, 1)) }
+
+// Decision is the outcome of taking a token from a bucket.
+type Decision struct {
+	Allowed    bool
+	Remaining  int           // whole tokens left after this request
+	RetryAfter time.Duration // when refused: wait until the next token
+}
+
+// BucketStore holds token-bucket state. Take refills key's bucket up to now under
+// policy l and tries to remove one token; it must be atomic per key. Keeping the state
+// in a shared store (see RedisBucketStore) makes the limit global across replicas.
+type BucketStore interface {
+	Take(ctx context.Context, key string, l Limit, now time.Time) (Decision, error)
+}
+
+// RateLimiter enforces per-user (or, for other routes, per-IP) token buckets with
+// separate policies for reads and writes, so short bursts pass while the average
+// rate stays bounded. If the store fails, requests are let through (fail open) so
+// that a limiter outage does not become an API outage; a warning is logged at most
+// once per failOpenWarnInterval.
+type RateLimiter struct {
+	read, write Limit
+	store       BucketStore
+	now         func() time.Time
+
+	// OnReject, if set, is called with the budget ("read" or "write") of every refused request.
+	OnReject func(class string)
+	// OnFailOpen, if set, is called with the budget of every request let through because
+	// the store failed.
+	OnFailOpen func(class string)
+
+	warnMu     sync.Mutex
+	lastWarn   time.Time // when the last fail-open warning was logged
+	suppressed int       // fail-opens since then that were not logged
+}
+
+// failOpenWarnInterval bounds how often a failing store is logged, so that an outage
+// does not log a line per request. The next warning reports the requests in between.
+const failOpenWarnInterval = time.Minute
+
+// NewRateLimiter constructs a limiter with the given read and write policies.
+// A nil store selects the in-process MemoryBucketStore.
+func NewRateLimiter(store BucketStore, read, write Limit) *RateLimiter {
+	if store == nil {
+		store = NewMemoryBucketStore()
+	}
+	return &RateLimiter{read: read, write: write, store: store, now: time.Now}
+}
+
+// bucket is the state of one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+	full   time.Time // when the bucket will be full again if left idle
+}
+
+// MemoryBucketStore keeps buckets in process memory. It is the default and is exact
+// for a single replica. Buckets that have refilled completely carry no state and are
+// evicted, which keeps memory proportional to the recently active clients.
+type MemoryBucketStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// sweepInterval bounds how often idle buckets are evicted.
+const sweepInterval = time.Minute
+
+// NewMemoryBucketStore returns an empty in-process store.
+func NewMemoryBucketStore() *MemoryBucketStore {
+	return &MemoryBucketStore{buckets: make(map[string]*bucket)}
+}
+
+// Take implements BucketStore.
+func (m *MemoryBucketStore) Take(_ context.Context, key string, l Limit, now time.Time) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst(), last: now}
+		m.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst(), b.tokens+elapsed.Seconds()*l.Rate)
+		b.last = now
+	}
+	var d Decision
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	d.Remaining = int(b.tokens)
+	b.full = now.Add(time.Duration((l.burst() - b.tokens) / l.Rate * float64(time.Second)))
+	return d, nil
+}
+
+// sweep evicts buckets that are full again: dropping them loses nothing, since a
+// new bucket starts full. Runs at most once per sweepInterval. Callers must hold m.mu.
+func (m *MemoryBucketStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+// Middleware wraps the handler and enforces the rate limit policy. Every limited
+// response carries RateLimit-Limit and RateLimit-Remaining; a 429 adds Retry-After.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, l := "read", rl.read
+		if requiredScope(r.Method) == ScopeWrite {
+			class, l = "write", rl.write
+		}
+		if !l.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := clientIP(r)
+		if u := parseUserFromPath(r.URL.Path); u != "" {
+			key = "user:" + u
+		}
+		d, err := rl.store.Take(r.Context(), class+"|"+key, l, rl.now())
+		if err != nil {
+			rl.failOpen(r, class, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(int(l.burst())))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		if !d.Allowed {
+			if rl.OnReject != nil {
+				rl.OnReject(class)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+			WriteError(w, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// failOpen records a request let through because the store failed with err.
+func (rl *RateLimiter) failOpen(r *http.Request, class string, err error) {
+	if rl.OnFailOpen != nil {
+		rl.OnFailOpen(class)
+	}
+	rl.warnMu.Lock()
+	now := rl.now()
+	if !rl.lastWarn.IsZero() && now.Sub(rl.lastWarn) < failOpenWarnInterval {
+		rl.suppressed++
+		rl.warnMu.Unlock()
+		return
+	}
+	suppressed := rl.suppressed
+	rl.lastWarn, rl.suppressed = now, 0
+	rl.warnMu.Unlock()
+	slog.WarnContext(r.Context(), "rate limiter unavailable, allowing requests", "err", err, "suppressed", suppressed)
+}
+
+// clientIP returns the host part of the remote address, so that all connections
+// from one client share a bucket.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces limiter keys in a Redis instance shared with other uses.
+const redisKeyPrefix = "ratelimit:"
+
+// takeScript is the token-bucket step run atomically inside Redis. The bucket is a hash
+// {tokens, last}; last is in milliseconds of the caller's clock. The key expires once the
+// bucket would be full again, so idle clients cost nothing and expiry loses no state.
+//
+// KEYS[1] bucket key; ARGV rate (tokens/s), burst, now (ms).
+// Returns {allowed (0/1), whole tokens remaining, ms until the next token when refused}.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local s = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(s[1]) or burst
+local last = tonumber(s[2]) or now
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) * rate)
+	last = now
+end
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(last))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, math.floor(tokens), wait}
+`)
+
+// RedisBucketStore keeps buckets in Redis (or any server speaking its protocol with
+// Lua scripting), so that all replicas of the API draw from the same budget.
+type RedisBucketStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisBucketStore wraps an existing client; Close closes it.
+func NewRedisBucketStore(client redis.UniversalClient) *RedisBucketStore {
+	return &RedisBucketStore{client: client}
+}
+
+// OpenRedisBucketStore connects to the server at url (redis://[user:pass@]host:port/db)
+// and checks that it is reachable. Close releases the connection pool.
+func OpenRedisBucketStore(ctx context.Context, url string) (*RedisBucketStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &RedisBucketStore{client: client}, nil
+}
+
+// Take implements BucketStore.
+func (s *RedisBucketStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Decision, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, l.Rate, l.burst(), now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("redis rate limit: %w", err)
+	}
+	if len(res) != 3 {
+		return Decision{}, fmt.Errorf("redis rate limit: unexpected reply %v", res)
+	}
+	return Decision{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+// Close closes the underlying client.
+func (s *RedisBucketStore) Close() error { return s.client.Close() }
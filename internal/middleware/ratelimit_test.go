@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(store BucketStore, read, write Limit) (*RateLimiter, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	rl := NewRateLimiter(store, read, write)
+	rl.now = func() time.Time { return now }
+	return rl, &now
+}
+
+// TestRateLimiter_BurstThenRate checks that a burst passes back-to-back and that
+// afterwards tokens come back at the configured rate, with the standard headers set.
+func TestRateLimiter_BurstThenRate(t *testing.T) {
+	rl, now := newTestLimiter(nil, Limit{Rate: 2, Burst: 3}, Limit{})
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/kostas/favourites", nil))
+		return rr
+	}
+
+	for i, want := range []string{"2", "1", "0"} {
+		rr := get()
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != want || rr.Header().Get("RateLimit-Limit") != "3" {
+			t.Fatalf("burst request %d: status=%d remaining=%q limit=%q", i, rr.Code, rr.Header().Get("RateLimit-Remaining"), rr.Header().Get("RateLimit-Limit"))
+		}
+	}
+	rr := get()
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("over burst: status=%d retry-after=%q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// at 2 tokens/s one request is allowed again after 500ms, not before
+	*now = now.Add(400 * time.Millisecond)
+	if rr := get(); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("after 400ms: status=%d", rr.Code)
+	}
+	*now = now.Add(100 * time.Millisecond)
+	if rr := get(); rr.Code != http.StatusOK {
+		t.Fatalf("after 500ms: status=%d", rr.Code)
+	}
+}
+
+// TestRateLimiter_SeparateBudgetsAndKeys checks that reads, writes and users have independent buckets.
+func TestRateLimiter_SeparateBudgetsAndKeys(t *testing.T) {
+	rl, _ := newTestLimiter(nil, Limit{Rate: 1, Burst: 1}, Limit{Rate: 1, Burst: 1})
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	do := func(method, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr.Code
+	}
+	if do(http.MethodGet, "/users/kostas/favourites") != http.StatusOK ||
+		do(http.MethodPost, "/users/kostas/favourites") != http.StatusOK ||
+		do(http.MethodGet, "/users/maria/favourites") != http.StatusOK {
+		t.Fatalf("independent buckets must each allow their first request")
+	}
+	if do(http.MethodDelete, "/users/kostas/favourites/x") != http.StatusTooManyRequests {
+		t.Fatalf("second write for kostas should be limited")
+	}
+}
+
+// TestRateLimiter_EvictsRefilledBuckets checks that idle clients do not accumulate state.
+func TestRateLimiter_EvictsRefilledBuckets(t *testing.T) {
+	m := NewMemoryBucketStore()
+	l := Limit{Rate: 10, Burst: 5}
+	now := time.Unix(1_700_000_000, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		m.Take(context.Background(), key, l, now)
+	}
+	m.Take(context.Background(), "d", l, now.Add(2*sweepInterval))
+	if len(m.buckets) != 1 {
+		t.Fatalf("expected only the active bucket to remain, have %d", len(m.buckets))
+	}
+}
+
+// TestRedisBucketStore checks the Redis-backed bucket against a miniredis stand-in:
+// same burst/refill behaviour as the in-process store, a budget shared by limiters
+// on different replicas, keys that expire once full, and failing open when the
+// server is gone.
+func TestRedisBucketStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisBucketStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer store.Close()
+
+	read := Limit{Rate: 2, Burst: 2}
+	replicaA, nowA := newTestLimiter(store, read, Limit{})
+	replicaB, nowB := newTestLimiter(store, read, Limit{})
+	get := func(rl *RateLimiter) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})).
+			ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/kostas/favourites", nil))
+		return rr
+	}
+
+	if rr := get(replicaA); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("first request: status=%d remaining=%q", rr.Code, rr.Header().Get("RateLimit-Remaining"))
+	}
+	if rr := get(replicaB); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("second request on the other replica: status=%d remaining=%q", rr.Code, rr.Header().Get("RateLimit-Remaining"))
+	}
+	if rr := get(replicaA); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("over the shared burst: status=%d retry-after=%q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// at 2 tokens/s one request is allowed again after 500ms
+	*nowA = nowA.Add(500 * time.Millisecond)
+	*nowB = *nowA
+	if rr := get(replicaB); rr.Code != http.StatusOK {
+		t.Fatalf("after 500ms: status=%d", rr.Code)
+	}
+
+	key := redisKeyPrefix + "read|user:kostas"
+	if !mr.Exists(key) || mr.TTL(key) <= 0 {
+		t.Fatalf("expected %s with a ttl, exists=%v ttl=%v", key, mr.Exists(key), mr.TTL(key))
+	}
+	mr.FastForward(mr.TTL(key))
+	if mr.Exists(key) {
+		t.Fatalf("bucket should expire once it has refilled")
+	}
+
+	// with the server gone requests pass; each is counted, but only one warning is logged per interval
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	failedOpen := 0
+	replicaA.OnFailOpen = func(class string) { failedOpen++ }
+	mr.Close()
+	for i := 0; i < 3; i++ {
+		if rr := get(replicaA); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("with redis down: status=%d limit=%q", rr.Code, rr.Header().Get("RateLimit-Limit"))
+		}
+	}
+	*nowA = nowA.Add(failOpenWarnInterval)
+	get(replicaA)
+	if failedOpen != 4 || strings.Count(logs.String(), "rate limiter unavailable") != 2 || !strings.Contains(logs.String(), "suppressed=2") {
+		t.Fatalf("fail-opens counted %d, logged:\n%s", failedOpen, logs.String())
+	}
+}
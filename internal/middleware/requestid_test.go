@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidV4Re = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// TestRequestID checks that well-formed inbound IDs are kept, others are replaced by
+// random UUIDs, and that the ID reaches the context and error bodies.
+func TestRequestID(t *testing.T) {
+	var fromCtx string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromCtx = RequestIDFromContext(r.Context())
+		WriteError(w, r, http.StatusTeapot, "teapot", "nope")
+	}))
+	do := func(inbound string) (string, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if inbound != "" {
+			req.Header.Set(RequestIDHeader, inbound)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if got := rr.Header().Get(RequestIDHeader); got != fromCtx {
+			t.Fatalf("header %q != context %q", got, fromCtx)
+		}
+		return fromCtx, rr
+	}
+
+	for _, id := range []string{"gw-123", "01HF8Z6Q3K1V9W2X7Y5Z4A0B1C", "3f2c1b9e-8d7a-4c6b-9a1f-0e2d3c4b5a69", "span:1.2_3"} {
+		if got, _ := do(id); got != id {
+			t.Errorf("inbound %q replaced by %q", id, got)
+		}
+	}
+	seen := map[string]bool{}
+	for _, id := range []string{"", "has space", "line\nbreak", `quote"`, strings.Repeat("a", 129)} {
+		got, _ := do(id)
+		if !uuidV4Re.MatchString(got) || seen[got] {
+			t.Errorf("inbound %q: generated %q is not a fresh UUID", id, got)
+		}
+		seen[got] = true
+	}
+
+	id, rr := do("gw-123")
+	var body Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.RequestID != id || body.Detail != "nope" || body.Code != "teapot" ||
+		body.Type != ProblemTypePrefix+"teapot" || body.Status != http.StatusTeapot || body.Instance != "/" {
+		t.Fatalf("error body = %s (%v)", rr.Body.String(), err)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
+)
+
+const tracerName = "github.com/KostasDasios/platform-go-challenge/internal/middleware"
+
+// traceContext reads and writes W3C traceparent/tracestate headers.
+var traceContext = propagation.TraceContext{}
+
+// Tracing starts a server span for every request, named after its route template.
+// An inbound W3C traceparent header makes the span a child of the caller's span, so
+// the request joins the caller's trace. The span is tagged with the X-Request-ID set
+// by RequestID, and the trace and span IDs are attached to the logging context, so
+// log lines, request IDs and traces can be joined in either direction.
+func Tracing(route func(*http.Request) string, next http.Handler) http.Handler {
+	tracer := otel.Tracer(tracerName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		tmpl := route(r)
+		ctx, span := tracer.Start(ctx, r.Method+" "+tmpl,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(tmpl),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("http.request.id", RequestIDFromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.With(ctx, slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+		}
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sr.status))
+		if sr.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", sr.status))
+		}
+	})
+}
@@ -47,10 +47,65 @@ type Audience struct {
 
 // Favourite is a user-saved asset with metadata.
 // Asset keeps the raw JSON to allow payloads per type.
+// UpdatedAt is nil until the favourite is modified for the first time.
+// Version starts at 1 and is incremented by every mutation; it backs the ETag header.
 type Favourite struct {
 	ID          string          `json:"id"`
 	Type        AssetType       `json:"type"`
 	Description string          `json:"description,omitempty"`
 	Asset       json.RawMessage `json:"asset"`
 	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   *time.Time      `json:"updated_at,omitempty"`
+	Version     int64           `json:"version"`
+
+	// Tags are the user's own labels for the favourite, normalised and sorted by the
+	// service; nil when the favourite has none.
+	Tags []string `json:"tags,omitempty"`
+
+	// AssetID references a catalog asset instead of embedding a copy. Asset is then
+	// filled in from the catalog whenever the favourite is read (null if the asset was
+	// deleted), and AssetVersion reports which version of the asset it shows.
+	AssetID        string     `json:"asset_id,omitempty"`
+	AssetVersion   int64      `json:"asset_version,omitempty"`
+	AssetUpdatedAt *time.Time `json:"-"`
+
+	// SearchText holds the lower-cased asset fields (title, text) matched by list
+	// search. It is derived from Asset by the service and never sent to clients.
+	SearchText string `json:"-"`
+
+	// ContentHash identifies the favourite's content (the canonical asset JSON, or the
+	// referenced asset ID) so a user cannot save the same asset twice. It is empty for
+	// favourites exempt from that check, e.g. legacy imports.
+	ContentHash string `json:"-"`
+}
+
+// Asset is an entry of the shared asset catalog. Favourites reference it by ID, so
+// an update to the asset is seen by every user who saved it.
+// Type and CreatedAt are immutable; Version is incremented by every update.
+type Asset struct {
+	ID          string          `json:"id"`
+	Type        AssetType       `json:"type"`
+	Description string          `json:"description,omitempty"`
+	Data        json.RawMessage `json:"asset"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   *time.Time      `json:"updated_at,omitempty"`
+	Version     int64           `json:"version"`
+}
+
+// TagCount is one of a user's tags with the number of favourites carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Collection is a user-owned, named folder of favourites. A favourite may belong to
+// several collections; FavouriteIDs lists the members in the user's manual order.
+// Version is incremented by every rename or membership change.
+type Collection struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	FavouriteIDs []string   `json:"favourite_ids"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	Version      int64      `json:"version"`
 }
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// OpKind selects what a batch operation does.
+type OpKind string
+
+const (
+	OpCreate OpKind = "create"
+	OpUpdate OpKind = "update"
+	OpDelete OpKind = "delete"
+)
+
+// Op is one write in an atomic batch (see Repository.Apply).
+type Op struct {
+	Kind      OpKind
+	Fav       *models.Favourite // OpCreate: the favourite to store
+	FavID     string            // OpUpdate, OpDelete: the target favourite
+	Update    Update            // OpUpdate: the change, including its precondition
+	IfVersion int64             // OpDelete: non-zero makes the delete conditional
+}
+
+// BatchError reports the operation that aborted an atomic batch.
+// errors.Is sees through it, e.g. to ErrNotFound or ErrVersionMismatch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string { return fmt.Sprintf("operation %d: %v", e.Index, e.Err) }
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// plan resolves ops in order against the stored state returned by get and owner (the
+// stored favourite holding a content hash) and yields the state each op leaves behind
+// (nil for a delete). Earlier ops in the batch are visible to later ones, so e.g. two
+// updates of the same favourite chain their versions and a delete frees its content hash.
+// Nothing is written; the first failing op is reported as a *BatchError.
+func plan(ops []Op, get func(favID string) *models.Favourite, owner func(hash string) string) ([]*models.Favourite, error) {
+	staged := make(map[string]*models.Favourite) // favID -> pending state, nil once deleted
+	lookup := func(favID string) *models.Favourite {
+		if f, ok := staged[favID]; ok {
+			return f
+		}
+		return get(favID)
+	}
+	unique := func(f *models.Favourite) error {
+		if f.ContentHash == "" {
+			return nil
+		}
+		for id, s := range staged {
+			if s != nil && id != f.ID && s.ContentHash == f.ContentHash {
+				return &DuplicateError{ExistingID: id}
+			}
+		}
+		if id := owner(f.ContentHash); id != "" && id != f.ID {
+			if _, changed := staged[id]; !changed {
+				return &DuplicateError{ExistingID: id}
+			}
+		}
+		return nil
+	}
+	out := make([]*models.Favourite, len(ops))
+	for i, op := range ops {
+		switch op.Kind {
+		case OpCreate:
+			if op.Fav == nil {
+				return nil, &BatchError{Index: i, Err: errors.New("create without favourite")}
+			}
+			if err := unique(op.Fav); err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			staged[op.Fav.ID] = op.Fav
+			out[i] = op.Fav
+		case OpUpdate, OpDelete:
+			cur := lookup(op.FavID)
+			if cur == nil {
+				return nil, &BatchError{Index: i, Err: ErrNotFound}
+			}
+			ifVersion := op.IfVersion
+			if op.Kind == OpUpdate {
+				ifVersion = op.Update.IfVersion
+			}
+			if err := checkVersion(cur, ifVersion); err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			if op.Kind == OpUpdate {
+				out[i] = op.Update.apply(cur)
+				if err := unique(out[i]); err != nil {
+					return nil, &BatchError{Index: i, Err: err}
+				}
+			}
+			staged[op.FavID] = out[i]
+		default:
+			return nil, &BatchError{Index: i, Err: fmt.Errorf("unknown op %q", op.Kind)}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// AssetRepository stores the shared asset catalog that favourites reference by ID.
+// Like Repository, every method honours ctx; missing assets yield ErrNotFound and
+// failed preconditions ErrVersionMismatch.
+type AssetRepository interface {
+	ListAssets(ctx context.Context, q AssetQuery) (*AssetPage, error)
+	CreateAsset(ctx context.Context, a *models.Asset) error
+	GetAsset(ctx context.Context, id string) (*models.Asset, error)
+	// GetAssets returns the assets among ids that exist, keyed by ID. Favourite
+	// listings use it to resolve all references of a page in one call.
+	GetAssets(ctx context.Context, ids []string) (map[string]*models.Asset, error)
+	UpdateAsset(ctx context.Context, id string, u AssetUpdate) (*models.Asset, error)
+	// DeleteAsset removes an asset. A non-zero ifVersion makes the delete conditional.
+	DeleteAsset(ctx context.Context, id string, ifVersion int64) error
+}
+
+// AssetQuery selects one page of the catalog, newest first. A Limit <= 0 returns everything.
+type AssetQuery struct {
+	Limit  int
+	Offset int
+	Types  []models.AssetType // any of these types; empty means all
+}
+
+// AssetPage is one page of the catalog; Total counts every matching asset.
+type AssetPage struct {
+	Items []*models.Asset
+	Total int
+}
+
+// AssetUpdate replaces an asset's payload and description. A non-zero IfVersion
+// makes the write conditional.
+type AssetUpdate struct {
+	Data        json.RawMessage
+	Description string
+	UpdatedAt   time.Time
+	IfVersion   int64
+}
+
+// apply returns an updated copy of a; the original is never mutated.
+func (u AssetUpdate) apply(a *models.Asset) *models.Asset {
+	out := *a
+	out.Data = u.Data
+	out.Description = u.Description
+	at := u.UpdatedAt.UTC()
+	out.UpdatedAt = &at
+	out.Version++
+	return &out
+}
+
+// newerAsset orders the catalog newest first, ties broken by descending ID.
+func newerAsset(a, b *models.Asset) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// InMemoryAssetRepo is a thread-safe in-memory asset catalog.
+type InMemoryAssetRepo struct {
+	mu     sync.RWMutex
+	assets map[string]*models.Asset
+}
+
+func NewInMemoryAssetRepo() *InMemoryAssetRepo {
+	return &InMemoryAssetRepo{assets: make(map[string]*models.Asset)}
+}
+
+// ListAssets filters and sorts the whole catalog; it is expected to stay small
+// compared to the favourites that reference it.
+func (r *InMemoryAssetRepo) ListAssets(ctx context.Context, q AssetQuery) (*AssetPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	all := make([]*models.Asset, 0, len(r.assets))
+	for _, a := range r.assets {
+		if len(q.Types) == 0 || slices.Contains(q.Types, a.Type) {
+			all = append(all, a)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return newerAsset(all[i], all[j]) })
+
+	start := min(max(q.Offset, 0), len(all))
+	end := len(all)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(all))
+	}
+	return &AssetPage{Items: all[start:end], Total: len(all)}, nil
+}
+
+func (r *InMemoryAssetRepo) CreateAsset(ctx context.Context, a *models.Asset) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assets[a.ID] = a
+	return nil
+}
+
+func (r *InMemoryAssetRepo) GetAsset(ctx context.Context, id string) (*models.Asset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.assets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return a, nil
+}
+
+func (r *InMemoryAssetRepo) GetAssets(ctx context.Context, ids []string) (map[string]*models.Asset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]*models.Asset, len(ids))
+	for _, id := range ids {
+		if a, ok := r.assets[id]; ok {
+			out[id] = a
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryAssetRepo) UpdateAsset(ctx context.Context, id string, u AssetUpdate) (*models.Asset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.assets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if u.IfVersion != 0 && a.Version != u.IfVersion {
+		return nil, ErrVersionMismatch
+	}
+	upd := u.apply(a)
+	r.assets[id] = upd
+	return upd, nil
+}
+
+func (r *InMemoryAssetRepo) DeleteAsset(ctx context.Context, id string, ifVersion int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.assets[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != 0 && a.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	delete(r.assets, id)
+	return nil
+}
+
+// snapshot returns every asset; used by the file backend to persist the catalog.
+func (r *InMemoryAssetRepo) snapshot() []*models.Asset {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*models.Asset, 0, len(r.assets))
+	for _, a := range r.assets {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return newerAsset(out[i], out[j]) })
+	return out
+}
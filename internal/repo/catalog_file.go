@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+const catalogFileName = "assets.json"
+
+// FileAssetRepo persists the asset catalog next to the favourites log. The catalog
+// changes rarely, so every mutation rewrites the whole file through a temporary file
+// and an atomic rename instead of keeping a log of its own.
+type FileAssetRepo struct {
+	mu   sync.Mutex // serialises writers so the file always matches memory
+	mem  *InMemoryAssetRepo
+	path string
+}
+
+// OpenFileAssetRepo opens (or creates) the catalog stored in dir.
+func OpenFileAssetRepo(dir string) (*FileAssetRepo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	r := &FileAssetRepo{mem: NewInMemoryAssetRepo(), path: filepath.Join(dir, catalogFileName)}
+	b, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read catalog: %w", err)
+	}
+	var stored []*models.Asset
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("corrupt catalog: %w", err)
+	}
+	for _, a := range stored {
+		r.mem.assets[a.ID] = a
+	}
+	return r, nil
+}
+
+// save writes the current catalog to disk. Callers must hold r.mu.
+func (r *FileAssetRepo) save() error {
+	b, err := json.Marshal(r.mem.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), catalogFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create catalog: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write catalog: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("install catalog: %w", err)
+	}
+	return nil
+}
+
+// write runs fn against the in-memory catalog and persists the result. If saving
+// fails, undo restores the previous state so memory never runs ahead of the file.
+func (r *FileAssetRepo) write(ctx context.Context, fn func() (undo func(), err error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	undo, err := fn()
+	if err != nil {
+		return err
+	}
+	if err := r.save(); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+func (r *FileAssetRepo) ListAssets(ctx context.Context, q AssetQuery) (*AssetPage, error) {
+	return r.mem.ListAssets(ctx, q)
+}
+
+func (r *FileAssetRepo) GetAsset(ctx context.Context, id string) (*models.Asset, error) {
+	return r.mem.GetAsset(ctx, id)
+}
+
+func (r *FileAssetRepo) GetAssets(ctx context.Context, ids []string) (map[string]*models.Asset, error) {
+	return r.mem.GetAssets(ctx, ids)
+}
+
+func (r *FileAssetRepo) CreateAsset(ctx context.Context, a *models.Asset) error {
+	return r.write(ctx, func() (func(), error) {
+		prev, existed := r.mem.assets[a.ID]
+		err := r.mem.CreateAsset(ctx, a)
+		return func() { r.restore(a.ID, prev, existed) }, err
+	})
+}
+
+func (r *FileAssetRepo) UpdateAsset(ctx context.Context, id string, u AssetUpdate) (*models.Asset, error) {
+	var upd *models.Asset
+	err := r.write(ctx, func() (func(), error) {
+		prev, existed := r.mem.assets[id]
+		var err error
+		upd, err = r.mem.UpdateAsset(ctx, id, u)
+		return func() { r.restore(id, prev, existed) }, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
+func (r *FileAssetRepo) DeleteAsset(ctx context.Context, id string, ifVersion int64) error {
+	return r.write(ctx, func() (func(), error) {
+		prev, existed := r.mem.assets[id]
+		err := r.mem.DeleteAsset(ctx, id, ifVersion)
+		return func() { r.restore(id, prev, existed) }, err
+	})
+}
+
+// restore puts back the state of one asset after a failed save.
+func (r *FileAssetRepo) restore(id string, prev *models.Asset, existed bool) {
+	r.mem.mu.Lock()
+	defer r.mem.mu.Unlock()
+	if existed {
+		r.mem.assets[id] = prev
+	} else {
+		delete(r.mem.assets, id)
+	}
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// SQLiteRepo also implements AssetRepository: the catalog lives in the assets table
+// of the same database as the favourites that reference it.
+var _ AssetRepository = (*SQLiteRepo)(nil)
+
+const assetColumns = `id, type, description, data, created_at, updated_at, version`
+
+func scanAsset(row rowScanner) (*models.Asset, error) {
+	var (
+		a       models.Asset
+		data    []byte
+		created int64
+		updated sql.NullInt64
+	)
+	if err := row.Scan(&a.ID, &a.Type, &a.Description, &data, &created, &updated, &a.Version); err != nil {
+		return nil, err
+	}
+	a.Data = data
+	a.CreatedAt = time.Unix(0, created).UTC()
+	if updated.Valid {
+		t := time.Unix(0, updated.Int64).UTC()
+		a.UpdatedAt = &t
+	}
+	return &a, nil
+}
+
+// collectAssets scans every row of rows.
+func collectAssets(rows *sql.Rows) ([]*models.Asset, error) {
+	defer rows.Close()
+	out := make([]*models.Asset, 0)
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// inList renders n placeholders for an IN clause.
+func inList(n int) string {
+	return `(?` + strings.Repeat(`, ?`, n-1) + `)`
+}
+
+func (r *SQLiteRepo) ListAssets(ctx context.Context, q AssetQuery) (*AssetPage, error) {
+	where, args := `1 = 1`, []any{}
+	if len(q.Types) > 0 {
+		where = `type IN ` + inList(len(q.Types))
+		for _, t := range q.Types {
+			args = append(args, string(t))
+		}
+	}
+	page := &AssetPage{}
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM assets WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+assetColumns+` FROM assets WHERE `+where+
+		` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, max(q.Offset, 0))...)
+	if err != nil {
+		return nil, err
+	}
+	if page.Items, err = collectAssets(rows); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (r *SQLiteRepo) CreateAsset(ctx context.Context, a *models.Asset) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO assets (`+assetColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.Type, a.Description, []byte(a.Data), a.CreatedAt.UnixNano(), nullableTime(a.UpdatedAt), max(a.Version, 1))
+	return err
+}
+
+func (r *SQLiteRepo) GetAsset(ctx context.Context, id string) (*models.Asset, error) {
+	a, err := scanAsset(r.db.QueryRowContext(ctx, `SELECT `+assetColumns+` FROM assets WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *SQLiteRepo) GetAssets(ctx context.Context, ids []string) (map[string]*models.Asset, error) {
+	out := make(map[string]*models.Asset, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+assetColumns+` FROM assets WHERE id IN `+inList(len(ids)), args...)
+	if err != nil {
+		return nil, err
+	}
+	found, err := collectAssets(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range found {
+		out[a.ID] = a
+	}
+	return out, nil
+}
+
+func (r *SQLiteRepo) UpdateAsset(ctx context.Context, id string, u AssetUpdate) (*models.Asset, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE assets SET
+			data        = ?,
+			description = ?,
+			updated_at  = ?,
+			version     = version + 1
+		WHERE id = ? AND (? = 0 OR version = ?)
+		RETURNING `+assetColumns,
+		[]byte(u.Data), u.Description, u.UpdatedAt.UnixNano(), id, u.IfVersion, u.IfVersion)
+	a, err := scanAsset(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, r.assetMissReason(ctx, id)
+	}
+	return a, err
+}
+
+func (r *SQLiteRepo) DeleteAsset(ctx context.Context, id string, ifVersion int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM assets WHERE id = ? AND (? = 0 OR version = ?)`, id, ifVersion, ifVersion)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return r.assetMissReason(ctx, id)
+	}
+	return nil
+}
+
+// assetMissReason is missReason for the catalog.
+func (r *SQLiteRepo) assetMissReason(ctx context.Context, id string) error {
+	var one int
+	err := r.db.QueryRowContext(ctx, `SELECT 1 FROM assets WHERE id = ?`, id).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return err
+	default:
+		return ErrVersionMismatch
+	}
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// catalogs returns a fresh instance of every AssetRepository implementation.
+func catalogs(t *testing.T) map[string]AssetRepository {
+	t.Helper()
+	file, err := OpenFileAssetRepo(t.TempDir())
+	if err != nil {
+		t.Fatalf("open file catalog: %v", err)
+	}
+	sqlite, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "favourites.db"))
+	if err != nil {
+		t.Fatalf("open sqlite repo: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]AssetRepository{"memory": NewInMemoryAssetRepo(), "file": file, "sqlite": sqlite}
+}
+
+func newAsset(id string, typ models.AssetType, created time.Time) *models.Asset {
+	return &models.Asset{
+		ID: id, Type: typ, CreatedAt: created, Version: 1,
+		Data: json.RawMessage(fmt.Sprintf(`{"type":%q,"text":%q}`, typ, id)),
+	}
+}
+
+// TestAssetRepository_CRUD exercises the catalog contract shared by every backend.
+func TestAssetRepository_CRUD(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Second)
+	for name, r := range catalogs(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, typ := range []models.AssetType{models.AssetInsight, models.AssetChart, models.AssetInsight} {
+				if err := r.CreateAsset(ctx, newAsset(fmt.Sprintf("a%d", i), typ, base.Add(time.Duration(i)*time.Second))); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+
+			page, err := r.ListAssets(ctx, AssetQuery{Limit: 1, Offset: 1, Types: []models.AssetType{models.AssetInsight}})
+			if err != nil || page.Total != 2 || len(page.Items) != 1 || page.Items[0].ID != "a0" {
+				t.Fatalf("list = %+v, %v", page, err)
+			}
+
+			found, err := r.GetAssets(ctx, []string{"a1", "missing", "a2"})
+			if err != nil || len(found) != 2 || found["a1"] == nil || found["a2"] == nil {
+				t.Fatalf("GetAssets = %v, %v", found, err)
+			}
+
+			u := AssetUpdate{Data: json.RawMessage(`{"type":"insight","text":"new"}`), Description: "d", UpdatedAt: base, IfVersion: 2}
+			if _, err := r.UpdateAsset(ctx, "a0", u); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale update: want ErrVersionMismatch, got %v", err)
+			}
+			u.IfVersion = 1
+			upd, err := r.UpdateAsset(ctx, "a0", u)
+			if err != nil || upd.Version != 2 || upd.Description != "d" || upd.UpdatedAt == nil || upd.Type != models.AssetInsight {
+				t.Fatalf("update = %+v, %v", upd, err)
+			}
+			got, err := r.GetAsset(ctx, "a0")
+			if err != nil || string(got.Data) != string(u.Data) || !got.CreatedAt.Equal(base) {
+				t.Fatalf("get after update = %+v, %v", got, err)
+			}
+
+			if err := r.DeleteAsset(ctx, "a0", 1); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale delete: want ErrVersionMismatch, got %v", err)
+			}
+			if err := r.DeleteAsset(ctx, "a0", 2); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, err := r.GetAsset(ctx, "a0"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get deleted: want ErrNotFound, got %v", err)
+			}
+			if _, err := r.UpdateAsset(ctx, "a0", u); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("update deleted: want ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// TestFileAssetRepo_Reopen checks that the catalog survives a restart.
+func TestFileAssetRepo_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileAssetRepo(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := r.CreateAsset(ctx, newAsset("a", models.AssetInsight, time.Now().UTC())); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := r.CreateAsset(ctx, newAsset("b", models.AssetInsight, time.Now().UTC())); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := r.DeleteAsset(ctx, "b", 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	r, err = OpenFileAssetRepo(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	page, err := r.ListAssets(ctx, AssetQuery{})
+	if err != nil || page.Total != 1 || page.Items[0].ID != "a" {
+		t.Fatalf("after reopen: %+v, %v", page, err)
+	}
+}
+
+// TestRepository_AssetReference checks that every backend round-trips a favourite that
+// references a catalog asset instead of embedding one.
+func TestRepository_AssetReference(t *testing.T) {
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			f := newFav("ref")
+			f.Asset, f.AssetID = nil, "a1"
+			if err := r.Create(ctx, "kostas", f); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			got, err := r.Get(ctx, "kostas", "ref")
+			if err != nil || got.AssetID != "a1" || got.Asset != nil {
+				t.Fatalf("get = %+v, %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// CollectionRepository stores the collections users organise their favourites in.
+// Like Repository, every method honours ctx; missing collections yield ErrNotFound and
+// failed preconditions ErrVersionMismatch. Membership is stored as favourite IDs: the
+// repository does not check that they exist, so callers keep it in step with the
+// favourites through ForgetFavourites.
+type CollectionRepository interface {
+	// ListCollections returns all of a user's collections, oldest first.
+	ListCollections(ctx context.Context, userID string) ([]*models.Collection, error)
+	CreateCollection(ctx context.Context, userID string, c *models.Collection) error
+	GetCollection(ctx context.Context, userID, id string) (*models.Collection, error)
+	UpdateCollection(ctx context.Context, userID, id string, u CollectionUpdate) (*models.Collection, error)
+	// DeleteCollection removes a collection. A non-zero ifVersion makes the delete conditional.
+	DeleteCollection(ctx context.Context, userID, id string, ifVersion int64) error
+	// ForgetFavourites drops favIDs from every collection of the user, bumping the
+	// version of each collection that changes.
+	ForgetFavourites(ctx context.Context, userID string, favIDs []string, at time.Time) error
+}
+
+// CollectionUpdate renames a collection and/or replaces its ordered membership. Nil
+// fields are left unchanged. A non-zero IfVersion makes the write conditional.
+type CollectionUpdate struct {
+	Name         *string
+	FavouriteIDs []string
+	UpdatedAt    time.Time
+	IfVersion    int64
+}
+
+// apply returns an updated copy of c; the original is never mutated.
+func (u CollectionUpdate) apply(c *models.Collection) *models.Collection {
+	out := *c
+	if u.Name != nil {
+		out.Name = *u.Name
+	}
+	if u.FavouriteIDs != nil {
+		out.FavouriteIDs = slices.Clone(u.FavouriteIDs)
+	}
+	at := u.UpdatedAt.UTC()
+	out.UpdatedAt = &at
+	out.Version++
+	return &out
+}
+
+// olderCollection lists collections in creation order, ties broken by ID.
+func olderCollection(a, b *models.Collection) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// InMemoryCollectionRepo is a thread-safe in-memory CollectionRepository. Stored
+// collections are replaced on every change, never modified in place.
+type InMemoryCollectionRepo struct {
+	mu   sync.RWMutex
+	data map[string]map[string]*models.Collection // userID -> collection ID -> Collection
+}
+
+func NewInMemoryCollectionRepo() *InMemoryCollectionRepo {
+	return &InMemoryCollectionRepo{data: make(map[string]map[string]*models.Collection)}
+}
+
+func (r *InMemoryCollectionRepo) ListCollections(ctx context.Context, userID string) ([]*models.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	out := make([]*models.Collection, 0, len(r.data[userID]))
+	for _, c := range r.data[userID] {
+		out = append(out, c)
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return olderCollection(out[i], out[j]) })
+	return out, nil
+}
+
+func (r *InMemoryCollectionRepo) CreateCollection(ctx context.Context, userID string, c *models.Collection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(userID, c)
+	return nil
+}
+
+func (r *InMemoryCollectionRepo) GetCollection(ctx context.Context, userID, id string) (*models.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.data[userID][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+func (r *InMemoryCollectionRepo) UpdateCollection(ctx context.Context, userID, id string, u CollectionUpdate) (*models.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.data[userID][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if u.IfVersion != 0 && c.Version != u.IfVersion {
+		return nil, ErrVersionMismatch
+	}
+	upd := u.apply(c)
+	r.store(userID, upd)
+	return upd, nil
+}
+
+func (r *InMemoryCollectionRepo) DeleteCollection(ctx context.Context, userID, id string, ifVersion int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.data[userID][id]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != 0 && c.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	delete(r.data[userID], id)
+	return nil
+}
+
+func (r *InMemoryCollectionRepo) ForgetFavourites(ctx context.Context, userID string, favIDs []string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.data[userID] {
+		if upd := forget(c, favIDs, at); upd != nil {
+			r.store(userID, upd)
+		}
+	}
+	return nil
+}
+
+// forget returns a copy of c without favIDs, or nil if c holds none of them.
+func forget(c *models.Collection, favIDs []string, at time.Time) *models.Collection {
+	kept := slices.DeleteFunc(slices.Clone(c.FavouriteIDs), func(id string) bool { return slices.Contains(favIDs, id) })
+	if len(kept) == len(c.FavouriteIDs) {
+		return nil
+	}
+	return CollectionUpdate{FavouriteIDs: kept, UpdatedAt: at}.apply(c)
+}
+
+// store puts c under userID. Callers must hold the write lock.
+func (r *InMemoryCollectionRepo) store(userID string, c *models.Collection) {
+	if r.data[userID] == nil {
+		r.data[userID] = make(map[string]*models.Collection)
+	}
+	r.data[userID][c.ID] = c
+}
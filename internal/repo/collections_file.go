@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+const collectionsFileName = "collections.json"
+
+// FileCollectionRepo persists collections next to the favourites log. Like the asset
+// catalog, every mutation rewrites the whole file through a temporary file and an
+// atomic rename; collections are few and small compared to the favourites in them.
+type FileCollectionRepo struct {
+	mu   sync.Mutex // serialises writers so the file always matches memory
+	mem  *InMemoryCollectionRepo
+	path string
+}
+
+// OpenFileCollectionRepo opens (or creates) the collections stored in dir.
+func OpenFileCollectionRepo(dir string) (*FileCollectionRepo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	r := &FileCollectionRepo{mem: NewInMemoryCollectionRepo(), path: filepath.Join(dir, collectionsFileName)}
+	b, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read collections: %w", err)
+	}
+	var stored map[string][]*models.Collection
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("corrupt collections: %w", err)
+	}
+	for userID, cs := range stored {
+		for _, c := range cs {
+			r.mem.store(userID, c)
+		}
+	}
+	return r, nil
+}
+
+// save writes every user's collections to disk. Callers must hold r.mu.
+func (r *FileCollectionRepo) save() error {
+	r.mem.mu.RLock()
+	all := make(map[string][]*models.Collection, len(r.mem.data))
+	for userID, m := range r.mem.data {
+		for _, c := range m {
+			all[userID] = append(all[userID], c)
+		}
+		sort.Slice(all[userID], func(i, j int) bool { return olderCollection(all[userID][i], all[userID][j]) })
+	}
+	r.mem.mu.RUnlock()
+	b, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), collectionsFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create collections: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write collections: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("install collections: %w", err)
+	}
+	return nil
+}
+
+// write runs fn against the user's in-memory collections and persists the result. If
+// saving fails, the user's previous collections are put back so memory never runs
+// ahead of the file.
+func (r *FileCollectionRepo) write(ctx context.Context, userID string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mem.mu.RLock()
+	prev := maps.Clone(r.mem.data[userID])
+	r.mem.mu.RUnlock()
+	if err := fn(); err != nil {
+		return err
+	}
+	r.mem.mu.RLock()
+	unchanged := maps.Equal(prev, r.mem.data[userID]) // collections are replaced, never modified
+	r.mem.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	if err := r.save(); err != nil {
+		r.mem.mu.Lock()
+		r.mem.data[userID] = prev
+		r.mem.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *FileCollectionRepo) ListCollections(ctx context.Context, userID string) ([]*models.Collection, error) {
+	return r.mem.ListCollections(ctx, userID)
+}
+
+func (r *FileCollectionRepo) GetCollection(ctx context.Context, userID, id string) (*models.Collection, error) {
+	return r.mem.GetCollection(ctx, userID, id)
+}
+
+func (r *FileCollectionRepo) CreateCollection(ctx context.Context, userID string, c *models.Collection) error {
+	return r.write(ctx, userID, func() error { return r.mem.CreateCollection(ctx, userID, c) })
+}
+
+func (r *FileCollectionRepo) UpdateCollection(ctx context.Context, userID, id string, u CollectionUpdate) (*models.Collection, error) {
+	var upd *models.Collection
+	err := r.write(ctx, userID, func() error {
+		var err error
+		upd, err = r.mem.UpdateCollection(ctx, userID, id, u)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
+func (r *FileCollectionRepo) DeleteCollection(ctx context.Context, userID, id string, ifVersion int64) error {
+	return r.write(ctx, userID, func() error { return r.mem.DeleteCollection(ctx, userID, id, ifVersion) })
+}
+
+func (r *FileCollectionRepo) ForgetFavourites(ctx context.Context, userID string, favIDs []string, at time.Time) error {
+	return r.write(ctx, userID, func() error { return r.mem.ForgetFavourites(ctx, userID, favIDs, at) })
+}
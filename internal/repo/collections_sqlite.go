@@ -0,0 +1,219 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// SQLiteRepo also implements CollectionRepository: collections live in the same
+// database as the favourites they organise.
+var _ CollectionRepository = (*SQLiteRepo)(nil)
+
+const collectionColumns = `id, name, created_at, updated_at, version`
+
+func scanCollection(row rowScanner) (*models.Collection, error) {
+	var (
+		c       models.Collection
+		created int64
+		updated sql.NullInt64
+	)
+	if err := row.Scan(&c.ID, &c.Name, &created, &updated, &c.Version); err != nil {
+		return nil, err
+	}
+	c.FavouriteIDs = make([]string, 0)
+	c.CreatedAt = time.Unix(0, created).UTC()
+	if updated.Valid {
+		t := time.Unix(0, updated.Int64).UTC()
+		c.UpdatedAt = &t
+	}
+	return &c, nil
+}
+
+// loadItems fills in the members of cs, in their manual order, with one query.
+func loadItems(ctx context.Context, db sqlExecutor, userID string, cs ...*models.Collection) error {
+	if len(cs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*models.Collection, len(cs))
+	args := []any{userID}
+	for _, c := range cs {
+		byID[c.ID] = c
+		args = append(args, c.ID)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT collection_id, fav_id FROM collection_items
+		WHERE user_id = ? AND collection_id IN `+inList(len(cs))+` ORDER BY collection_id, position`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, fid string
+		if err := rows.Scan(&cid, &fid); err != nil {
+			return err
+		}
+		c := byID[cid]
+		c.FavouriteIDs = append(c.FavouriteIDs, fid)
+	}
+	return rows.Err()
+}
+
+// storeItems replaces the members of a collection with favIDs, in that order.
+func storeItems(ctx context.Context, db sqlExecutor, userID, id string, favIDs []string) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM collection_items WHERE user_id = ? AND collection_id = ?`, userID, id); err != nil {
+		return err
+	}
+	for i, fid := range favIDs {
+		if _, err := db.ExecContext(ctx, `INSERT INTO collection_items (user_id, collection_id, fav_id, position) VALUES (?, ?, ?, ?)`,
+			userID, id, fid, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ListCollections(ctx context.Context, userID string) ([]*models.Collection, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+collectionColumns+` FROM collections WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.Collection, 0)
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadItems(ctx, r.db, userID, out...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *SQLiteRepo) CreateCollection(ctx context.Context, userID string, c *models.Collection) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+	if _, err := tx.ExecContext(ctx, `INSERT INTO collections (user_id, `+collectionColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, c.ID, c.Name, c.CreatedAt.UnixNano(), nullableTime(c.UpdatedAt), max(c.Version, 1)); err != nil {
+		return err
+	}
+	if err := storeItems(ctx, tx, userID, c.ID, c.FavouriteIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepo) GetCollection(ctx context.Context, userID, id string) (*models.Collection, error) {
+	c, err := scanCollection(r.db.QueryRowContext(ctx, `SELECT `+collectionColumns+` FROM collections WHERE user_id = ? AND id = ?`, userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := loadItems(ctx, r.db, userID, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateCollection bumps the collection row as a compare-and-swap and, when the
+// membership changes, rewrites its items in the same transaction.
+func (r *SQLiteRepo) UpdateCollection(ctx context.Context, userID, id string, u CollectionUpdate) (*models.Collection, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after Commit
+	row := tx.QueryRowContext(ctx, `UPDATE collections SET
+			name       = COALESCE(?, name),
+			updated_at = ?,
+			version    = version + 1
+		WHERE user_id = ? AND id = ? AND (? = 0 OR version = ?)
+		RETURNING `+collectionColumns,
+		u.Name, u.UpdatedAt.UnixNano(), userID, id, u.IfVersion, u.IfVersion)
+	c, err := scanCollection(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, collectionMissReason(ctx, tx, userID, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.FavouriteIDs != nil {
+		if err := storeItems(ctx, tx, userID, id, u.FavouriteIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadItems(ctx, tx, userID, c); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *SQLiteRepo) DeleteCollection(ctx context.Context, userID, id string, ifVersion int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM collections WHERE user_id = ? AND id = ? AND (? = 0 OR version = ?)`,
+		userID, id, ifVersion, ifVersion)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return collectionMissReason(ctx, r.db, userID, id)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ForgetFavourites(ctx context.Context, userID string, favIDs []string, at time.Time) error {
+	if len(favIDs) == 0 {
+		return nil
+	}
+	args := []any{userID}
+	for _, id := range favIDs {
+		args = append(args, id)
+	}
+	members := `user_id = ? AND fav_id IN ` + inList(len(favIDs))
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+	if _, err := tx.ExecContext(ctx, `UPDATE collections SET updated_at = ?, version = version + 1
+		WHERE user_id = ? AND id IN (SELECT collection_id FROM collection_items WHERE `+members+`)`,
+		append([]any{at.UnixNano(), userID}, args...)...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM collection_items WHERE `+members, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// collectionMissReason is missReason for collections.
+func collectionMissReason(ctx context.Context, db sqlExecutor, userID, id string) error {
+	var one int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM collections WHERE user_id = ? AND id = ?`, userID, id).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return err
+	default:
+		return ErrVersionMismatch
+	}
+}
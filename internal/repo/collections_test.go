@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// collectionRepos returns a fresh instance of every CollectionRepository implementation.
+func collectionRepos(t *testing.T) map[string]CollectionRepository {
+	t.Helper()
+	file, err := OpenFileCollectionRepo(t.TempDir())
+	if err != nil {
+		t.Fatalf("open file collections: %v", err)
+	}
+	sqlite, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "favourites.db"))
+	if err != nil {
+		t.Fatalf("open sqlite repo: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]CollectionRepository{"memory": NewInMemoryCollectionRepo(), "file": file, "sqlite": sqlite}
+}
+
+func newCollection(id string, created time.Time, favIDs ...string) *models.Collection {
+	return &models.Collection{ID: id, Name: "name " + id, FavouriteIDs: favIDs, CreatedAt: created, Version: 1}
+}
+
+// TestCollectionRepository_CRUD exercises the collection contract shared by every backend.
+func TestCollectionRepository_CRUD(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Second)
+	for name, r := range collectionRepos(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range []*models.Collection{
+				newCollection("c1", base.Add(time.Second), "f3", "f1"),
+				newCollection("c0", base, "f1", "f2"),
+			} {
+				if err := r.CreateCollection(ctx, "kostas", c); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+			if err := r.CreateCollection(ctx, "other", newCollection("c9", base)); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			cs, err := r.ListCollections(ctx, "kostas")
+			if err != nil || len(cs) != 2 || cs[0].ID != "c0" || fmt.Sprint(cs[1].FavouriteIDs) != "[f3 f1]" {
+				t.Fatalf("list = %+v, %v", cs, err)
+			}
+
+			name := "renamed"
+			u := CollectionUpdate{Name: &name, FavouriteIDs: []string{"f2", "f1", "f4"}, UpdatedAt: base, IfVersion: 2}
+			if _, err := r.UpdateCollection(ctx, "kostas", "c0", u); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale update: want ErrVersionMismatch, got %v", err)
+			}
+			u.IfVersion = 1
+			upd, err := r.UpdateCollection(ctx, "kostas", "c0", u)
+			if err != nil || upd.Name != "renamed" || upd.Version != 2 || upd.UpdatedAt == nil || fmt.Sprint(upd.FavouriteIDs) != "[f2 f1 f4]" {
+				t.Fatalf("update = %+v, %v", upd, err)
+			}
+			if upd, err = r.UpdateCollection(ctx, "kostas", "c0", CollectionUpdate{UpdatedAt: base}); err != nil || fmt.Sprint(upd.FavouriteIDs) != "[f2 f1 f4]" {
+				t.Fatalf("touch keeps members: %+v, %v", upd, err)
+			}
+
+			if err := r.ForgetFavourites(ctx, "kostas", []string{"f1", "f9"}, base); err != nil {
+				t.Fatalf("forget: %v", err)
+			}
+			c0, err := r.GetCollection(ctx, "kostas", "c0")
+			if err != nil || fmt.Sprint(c0.FavouriteIDs) != "[f2 f4]" || c0.Version != 4 {
+				t.Fatalf("c0 after forget = %+v, %v", c0, err)
+			}
+			c1, err := r.GetCollection(ctx, "kostas", "c1")
+			if err != nil || fmt.Sprint(c1.FavouriteIDs) != "[f3]" || c1.Version != 2 {
+				t.Fatalf("c1 after forget = %+v, %v", c1, err)
+			}
+
+			if err := r.DeleteCollection(ctx, "kostas", "c1", 1); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale delete: want ErrVersionMismatch, got %v", err)
+			}
+			if err := r.DeleteCollection(ctx, "kostas", "c1", 2); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, err := r.GetCollection(ctx, "kostas", "c1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get deleted: want ErrNotFound, got %v", err)
+			}
+			if _, err := r.GetCollection(ctx, "other", "c0"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("collections are per user, got %v", err)
+			}
+		})
+	}
+}
+
+// TestFileCollectionRepo_Reopen checks that collections and their order survive a restart.
+func TestFileCollectionRepo_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileCollectionRepo(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := r.CreateCollection(ctx, "kostas", newCollection("c", time.Now().UTC(), "f2", "f1")); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	r, err = OpenFileCollectionRepo(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	c, err := r.GetCollection(ctx, "kostas", "c")
+	if err != nil || fmt.Sprint(c.FavouriteIDs) != "[f2 f1]" {
+		t.Fatalf("after reopen: %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// ErrInvalidCursor is returned when a client-supplied cursor cannot be decoded
+// or was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortOrder selects the listing order. Every order ends with an id tie-breaker
+// so that it is total and keyset cursors never skip or repeat an item.
+type SortOrder string
+
+const (
+	SortCreatedDesc SortOrder = "-created_at" // newest first (default)
+	SortCreatedAsc  SortOrder = "created_at"  // oldest first
+	SortDescription SortOrder = "description" // by description, then id
+
+	// SortPosition is the manual order of a collection. The service applies it to the
+	// favourites of one collection; repositories do not sort by it.
+	SortPosition SortOrder = "position"
+)
+
+// ParseSortOrder validates a client-supplied sort parameter; empty means the default.
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch o := SortOrder(s); o {
+	case "":
+		return SortCreatedDesc, nil
+	case SortCreatedDesc, SortCreatedAsc, SortDescription, SortPosition:
+		return o, nil
+	}
+	return "", errors.New("invalid sort: want created_at, -created_at, description or position")
+}
+
+// less reports whether a is listed before b in order o.
+func (o SortOrder) less(a, b *models.Favourite) bool {
+	switch o {
+	case SortCreatedAsc:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	case SortDescription:
+		if a.Description != b.Description {
+			return a.Description < b.Description
+		}
+		return a.ID < b.ID
+	default:
+		return newer(a, b)
+	}
+}
+
+// Cursor identifies a position in a listing order: the sort key of the last item
+// returned plus its id as a tie-breaker. For SortPosition the key is the item's index
+// in the collection, and Collection names the collection it indexes.
+type Cursor struct {
+	Sort        SortOrder
+	ID          string
+	CreatedAt   time.Time
+	Description string
+	Position    int
+	Collection  string
+}
+
+// CursorOf returns the cursor positioned at f in order o.
+func CursorOf(f *models.Favourite, o SortOrder) *Cursor {
+	c := &Cursor{Sort: o, ID: f.ID}
+	if o == SortDescription {
+		c.Description = f.Description
+	} else {
+		c.CreatedAt = f.CreatedAt
+	}
+	return c
+}
+
+// Encode renders the cursor as an opaque, URL-safe token.
+// Clients must treat it as a black box; the layout may change between releases.
+func (c *Cursor) Encode() string {
+	var key string
+	switch c.Sort {
+	case SortDescription:
+		key = c.Description
+	case SortPosition:
+		key = strconv.Itoa(c.Position) + "|" + c.Collection
+	default:
+		key = strconv.FormatInt(c.CreatedAt.UnixNano(), 10)
+	}
+	// the free-form key goes last so it may contain the separator
+	raw := string(c.Sort) + "|" + c.ID + "|" + key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(b), "|", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+	o, err := ParseSortOrder(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{Sort: o, ID: parts[1]}
+	switch o {
+	case SortDescription:
+		c.Description = parts[2]
+		return c, nil
+	case SortPosition:
+		pos, collection, ok := strings.Cut(parts[2], "|")
+		if !ok || collection == "" {
+			return nil, ErrInvalidCursor
+		}
+		if c.Position, err = strconv.Atoi(pos); err != nil || c.Position < 0 {
+			return nil, ErrInvalidCursor
+		}
+		c.Collection = collection
+		return c, nil
+	}
+	n, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c.CreatedAt = time.Unix(0, n).UTC()
+	return c, nil
+}
+
+// covers reports whether f sits at or ahead of the cursor position,
+// i.e. it was already returned on an earlier page.
+func (c *Cursor) covers(f *models.Favourite) bool {
+	pos := &models.Favourite{ID: c.ID, CreatedAt: c.CreatedAt, Description: c.Description}
+	return !c.Sort.less(pos, f)
+}
+
+// newer is the default listing order: newest first, ties broken by descending id.
+func newer(a, b *models.Favourite) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
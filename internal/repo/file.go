@@ -0,0 +1,434 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+const (
+	walFileName      = "favourites.wal"
+	snapshotFileName = "favourites.snapshot"
+
+	opPut    = "put"
+	opDelete = "delete"
+	opBatch  = "batch"
+)
+
+// walRecord is one line of the write-ahead log (and of the snapshot).
+// Records carry the full resulting state, so replaying them is idempotent.
+type walRecord struct {
+	Op     string            `json:"op"`
+	UserID string            `json:"user_id"`
+	FavID  string            `json:"fav_id,omitempty"`
+	Fav    *models.Favourite `json:"fav,omitempty"`
+
+	// SearchText and ContentHash persist the favourite's server-side fields, which
+	// are excluded from its public JSON encoding.
+	SearchText  string `json:"search_text,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+
+	// Unhashed marks a favourite stored without a content hash on purpose. An empty hash
+	// without it was written before deduplication and is backfilled on open.
+	Unhashed bool `json:"unhashed,omitempty"`
+
+	// Ops holds the put/delete records of an atomic batch. They share one line,
+	// so a crash mid-append drops the whole batch as a torn tail.
+	Ops []walRecord `json:"ops,omitempty"`
+}
+
+// putRecord builds the record that stores fav under userID.
+func putRecord(userID string, fav *models.Favourite) walRecord {
+	return walRecord{Op: opPut, UserID: userID, Fav: fav, SearchText: fav.SearchText, ContentHash: fav.ContentHash, Unhashed: fav.ContentHash == ""}
+}
+
+// FileRepo persists favourites on local disk. Every mutation is appended to a
+// write-ahead log and fsynced before it is applied; after SnapshotEvery records
+// the log is compacted into a snapshot. At startup the snapshot is loaded and the
+// log replayed on top of it. Reads are served from an in-memory index.
+type FileRepo struct {
+	mu            sync.Mutex // serialises writers so log order matches apply order
+	mem           *InMemoryRepo
+	dir           string
+	wal           *os.File
+	walSize       int64 // bytes of fully written records, used to undo torn appends
+	pending       int   // records appended since the last snapshot
+	snapshotEvery int
+
+	legacy     map[*models.Favourite]bool // favourites loaded without a hash, only while opening
+	collisions []HashCollision            // found by the backfill when opening
+}
+
+// OpenFileRepo opens (or creates) a file-backed repository rooted at dir.
+// A snapshotEvery <= 0 disables automatic compaction.
+func OpenFileRepo(dir string, snapshotEvery int) (*FileRepo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	r := &FileRepo{mem: NewInMemoryRepo(), dir: dir, snapshotEvery: snapshotEvery, legacy: make(map[*models.Favourite]bool)}
+
+	if _, err := r.replay(filepath.Join(dir, snapshotFileName), false); err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+	walPath := filepath.Join(dir, walFileName)
+	n, err := r.replay(walPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("replay wal: %w", err)
+	}
+	r.pending = n
+
+	r.wal, err = os.OpenFile(walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	st, err := r.wal.Stat()
+	if err != nil {
+		r.wal.Close()
+		return nil, fmt.Errorf("stat wal: %w", err)
+	}
+	r.walSize = st.Size()
+	if err := r.backfillHashes(); err != nil {
+		r.wal.Close()
+		return nil, fmt.Errorf("backfill content hashes: %w", err)
+	}
+	return r, nil
+}
+
+// backfillHashes gives the favourites loaded without a content hash theirs, with the
+// duplicate policy of backfillHashes, and logs them all again as one batch so that the
+// next open finds nothing left to do.
+func (r *FileRepo) backfillHashes() error {
+	var legacy []stored
+	r.mem.each(func(userID string, fav *models.Favourite) {
+		if r.legacy[fav] {
+			legacy = append(legacy, stored{userID, fav})
+		}
+	})
+	r.legacy = nil
+	if len(legacy) == 0 {
+		return nil
+	}
+	hashed, collisions := backfillHashes(legacy, r.mem.owner)
+	rec := walRecord{Op: opBatch, Ops: make([]walRecord, len(hashed))}
+	for i, l := range hashed {
+		rec.Ops[i] = putRecord(l.userID, l.fav)
+	}
+	r.collisions = collisions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.commit(rec)
+}
+
+// HashCollisions lists the favourites the backfill on open left without a content hash
+// as duplicates. The backfill is logged, so they are only reported by the first open.
+func (r *FileRepo) HashCollisions() []HashCollision { return r.collisions }
+
+// replay applies every record found in path and returns how many were read.
+// A missing file is treated as empty. When truncateTorn is set, a trailing
+// partial line (left behind by a crash mid-append) is cut off instead of failing.
+func (r *FileRepo) replay(path string, truncateTorn bool) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var (
+		n      int
+		offset int64
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return n, nil
+			}
+			if !truncateTorn {
+				return n, fmt.Errorf("unterminated record at offset %d", offset)
+			}
+			return n, os.Truncate(path, offset)
+		}
+		if err != nil {
+			return n, err
+		}
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return n, fmt.Errorf("corrupt record at offset %d: %w", offset, err)
+		}
+		if err := r.apply(rec); err != nil {
+			return n, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+		n++
+	}
+}
+
+// apply mutates the in-memory index according to a log record.
+func (r *FileRepo) apply(rec walRecord) error {
+	switch rec.Op {
+	case opPut:
+		if rec.Fav == nil {
+			return errors.New("put without favourite")
+		}
+		if rec.Fav.Version == 0 {
+			rec.Fav.Version = 1 // records written before versioning was introduced
+		}
+		rec.Fav.SearchText = rec.SearchText
+		rec.Fav.ContentHash = rec.ContentHash
+		if r.legacy != nil && rec.ContentHash == "" && !rec.Unhashed {
+			r.legacy[rec.Fav] = true
+		}
+		r.mem.put(rec.UserID, rec.Fav)
+	case opDelete:
+		r.mem.remove(rec.UserID, rec.FavID)
+	case opBatch:
+		for _, sub := range rec.Ops {
+			if sub.Op == opBatch {
+				return errors.New("nested batch")
+			}
+			if err := r.apply(sub); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown op %q", rec.Op)
+	}
+	return nil
+}
+
+// commit appends rec to the log, fsyncs it and only then applies it in memory.
+// Callers must hold r.mu.
+func (r *FileRepo) commit(rec walRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := r.wal.Write(b); err != nil {
+		_ = r.wal.Truncate(r.walSize) // drop the partial line so later appends stay readable
+		return fmt.Errorf("append wal: %w", err)
+	}
+	if err := r.wal.Sync(); err != nil {
+		_ = r.wal.Truncate(r.walSize)
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	r.walSize += int64(len(b))
+	if err := r.apply(rec); err != nil {
+		return err
+	}
+	r.pending++
+	if r.snapshotEvery > 0 && r.pending >= r.snapshotEvery {
+		if err := r.snapshot(); err != nil {
+			// The record is already durable in the log; compaction is retried on the next write.
+			slog.Warn("wal compaction failed", "err", err)
+		}
+	}
+	return nil
+}
+
+// snapshot writes the full state to a temporary file, atomically renames it over
+// the previous snapshot and truncates the log. A crash between the rename and the
+// truncate is harmless: replaying the old log on top of the new snapshot converges.
+// Callers must hold r.mu.
+func (r *FileRepo) snapshot() error {
+	tmp, err := os.CreateTemp(r.dir, snapshotFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	var encErr error
+	r.mem.each(func(userID string, fav *models.Favourite) {
+		if encErr == nil {
+			encErr = enc.Encode(putRecord(userID, fav))
+		}
+	})
+	if encErr == nil {
+		encErr = w.Flush()
+	}
+	if encErr == nil {
+		encErr = tmp.Sync()
+	}
+	if cerr := tmp.Close(); encErr == nil {
+		encErr = cerr
+	}
+	if encErr != nil {
+		return fmt.Errorf("write snapshot: %w", encErr)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(r.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	if d, err := os.Open(r.dir); err == nil {
+		_ = d.Sync() // persist the rename; not supported on every platform
+		d.Close()
+	}
+	if err := r.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	r.walSize = 0
+	r.pending = 0
+	return nil
+}
+
+// Snapshot forces a compaction of the log into a snapshot.
+func (r *FileRepo) Snapshot() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot()
+}
+
+// Close flushes and closes the log file.
+func (r *FileRepo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.wal.Sync(); err != nil {
+		r.wal.Close()
+		return err
+	}
+	return r.wal.Close()
+}
+
+func (r *FileRepo) List(ctx context.Context, userID string, q ListQuery) (*ListPage, error) {
+	return r.mem.List(ctx, userID, q)
+}
+
+func (r *FileRepo) Get(ctx context.Context, userID, favID string) (*models.Favourite, error) {
+	return r.mem.Get(ctx, userID, favID)
+}
+
+func (r *FileRepo) CountByType(ctx context.Context) (map[models.AssetType]int, error) {
+	return r.mem.CountByType(ctx)
+}
+
+func (r *FileRepo) TagCounts(ctx context.Context, userID string) (map[string]int, error) {
+	return r.mem.TagCounts(ctx, userID)
+}
+
+// SetReferenceSearchText commits the changed references as one batch record, so the
+// refresh is replayed completely or not at all.
+func (r *FileRepo) SetReferenceSearchText(ctx context.Context, assetID, searchText string) (int, error) {
+	if err := r.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.mu.Unlock()
+	r.mem.mu.RLock()
+	refs := r.mem.references(assetID, searchText)
+	r.mem.mu.RUnlock()
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	rec := walRecord{Op: opBatch, Ops: make([]walRecord, len(refs))}
+	for i, ref := range refs {
+		rec.Ops[i] = putRecord(ref.userID, ref.fav)
+	}
+	if err := r.commit(rec); err != nil {
+		return 0, err
+	}
+	return len(refs), nil
+}
+
+// lock acquires the writer lock unless ctx is done first. Once a write holds the
+// lock it runs to completion, so a record is never left half-committed.
+func (r *FileRepo) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if err := ctx.Err(); err != nil { // cancelled while queued behind another writer
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *FileRepo) Create(ctx context.Context, userID string, fav *models.Favourite) error {
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	defer r.mu.Unlock()
+	if err := r.mem.unique(userID, fav); err != nil {
+		return err
+	}
+	return r.commit(putRecord(userID, fav))
+}
+
+func (r *FileRepo) Update(ctx context.Context, userID, favID string, u Update) (*models.Favourite, error) {
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+	cur, err := r.mem.Get(ctx, userID, favID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(cur, u.IfVersion); err != nil {
+		return nil, err
+	}
+	upd := u.apply(cur)
+	if err := r.mem.unique(userID, upd); err != nil {
+		return nil, err
+	}
+	if err := r.commit(putRecord(userID, upd)); err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
+func (r *FileRepo) Delete(ctx context.Context, userID, favID string, ifVersion int64) error {
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	defer r.mu.Unlock()
+	cur, err := r.mem.Get(ctx, userID, favID)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(cur, ifVersion); err != nil {
+		return err
+	}
+	return r.commit(walRecord{Op: opDelete, UserID: userID, FavID: favID})
+}
+
+// Apply validates the whole batch against the current state and commits it as a
+// single log record, so it is replayed either completely or not at all.
+func (r *FileRepo) Apply(ctx context.Context, userID string, ops []Op) ([]*models.Favourite, error) {
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+	out, err := plan(ops, func(favID string) *models.Favourite {
+		f, _ := r.mem.Get(ctx, userID, favID)
+		return f
+	}, func(hash string) string { return r.mem.owner(userID, hash) })
+	if err != nil {
+		return nil, err
+	}
+	rec := walRecord{Op: opBatch, UserID: userID, Ops: make([]walRecord, len(ops))}
+	for i, op := range ops {
+		if out[i] != nil {
+			rec.Ops[i] = putRecord(userID, out[i])
+		} else {
+			rec.Ops[i] = walRecord{Op: opDelete, UserID: userID, FavID: op.FavID}
+		}
+	}
+	if err := r.commit(rec); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,232 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+var ctx = context.Background()
+
+func strPtr(s string) *string { return &s }
+
+func newFav(id string) *models.Favourite {
+	return &models.Favourite{
+		ID:          id,
+		Type:        models.AssetInsight,
+		Description: "d",
+		Asset:       json.RawMessage(`{"type":"insight","text":"t"}`),
+		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+	}
+}
+
+// TestFileRepo_ReplayAfterRestart verifies that mutations survive reopening the repository.
+func TestFileRepo_ReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("a")); err != nil {
+		t.Fatalf("create a: %v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("b")); err != nil {
+		t.Fatalf("create b: %v", err)
+	}
+	if _, err := r.Update(ctx, "kostas", "a", Update{Description: strPtr("updated"), UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := r.Delete(ctx, "kostas", "b", 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	r, err = OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	page, _ := r.List(ctx, "kostas", ListQuery{})
+	list := page.Items
+	if len(list) != 1 || list[0].ID != "a" || list[0].Description != "updated" {
+		t.Fatalf("unexpected state after replay: %+v", list)
+	}
+}
+
+// TestFileRepo_SnapshotCompactsLog verifies that the log is truncated once the snapshot
+// threshold is reached and that the snapshot alone restores the state.
+func TestFileRepo_SnapshotCompactsLog(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir, 3)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := r.Create(ctx, "kostas", newFav(id)); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || st.Size() != 0 {
+		t.Fatalf("expected empty wal after snapshot, err=%v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("d")); err != nil {
+		t.Fatalf("create d: %v", err)
+	}
+	r.Close()
+
+	r, err = OpenFileRepo(dir, 3)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	if page, _ := r.List(ctx, "kostas", ListQuery{}); len(page.Items) != 4 {
+		t.Fatalf("expected 4 favourites after snapshot+replay, got %d", len(page.Items))
+	}
+}
+
+// TestFileRepo_TornTailIsTruncated simulates a crash mid-append.
+func TestFileRepo_TornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("a")); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	r.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	f.WriteString(`{"op":"put","user_id":"kostas","fav":{"id":"b"`)
+	f.Close()
+
+	r, err = OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen with torn tail: %v", err)
+	}
+	defer r.Close()
+	if page, _ := r.List(ctx, "kostas", ListQuery{}); len(page.Items) != 1 {
+		t.Fatalf("expected torn record to be dropped, got %d favourites", len(page.Items))
+	}
+	if err := r.Create(ctx, "kostas", newFav("c")); err != nil {
+		t.Fatalf("append after truncation: %v", err)
+	}
+}
+
+// TestFileRepo_BatchReplay verifies that a batch is logged as a single record and replayed whole.
+func TestFileRepo_BatchReplay(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := r.Apply(ctx, "kostas", []Op{
+		{Kind: OpCreate, Fav: newFav("a")},
+		{Kind: OpCreate, Fav: newFav("b")},
+		{Kind: OpDelete, FavID: "a"},
+	}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if r.pending != 1 {
+		t.Fatalf("expected one wal record for the batch, got %d", r.pending)
+	}
+	r.Close()
+
+	r, err = OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	page, _ := r.List(ctx, "kostas", ListQuery{})
+	if len(page.Items) != 1 || page.Items[0].ID != "b" {
+		t.Fatalf("unexpected state after replay: %+v", page.Items)
+	}
+}
+
+// TestFileRepo_ContentHashSurvivesRestart checks that uniqueness still holds after replay.
+func TestFileRepo_ContentHashSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f := newFav("a")
+	f.ContentHash = "h1"
+	if err := r.Create(ctx, "kostas", f); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	r.Close()
+
+	r, err = OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	dup := newFav("b")
+	dup.ContentHash = "h1"
+	if err := r.Create(ctx, "kostas", dup); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("want ErrDuplicate after restart, got %v", err)
+	}
+}
+
+// TestFileRepo_BackfillsContentHashes opens a log written before deduplication: the
+// oldest of two favourites with the same content gets the hash, the other stays exempt,
+// and the result is logged so a second open has nothing left to do.
+func TestFileRepo_BackfillsContentHashes(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"op":"put","user_id":"kostas","fav":{"id":"a","type":"insight","asset":{"type":"insight","text":"t"},"created_at":"2024-01-01T00:00:00Z","version":1}}
+{"op":"put","user_id":"kostas","fav":{"id":"b","type":"insight","asset":{"text":"t","type":"insight","description":"again"},"created_at":"2024-01-02T00:00:00Z","version":1}}
+{"op":"put","user_id":"kostas","fav":{"id":"r","type":"chart","asset":null,"asset_id":"x","created_at":"2024-01-03T00:00:00Z","version":1}}
+`
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(legacy), 0o644); err != nil {
+		t.Fatalf("write wal: %v", err)
+	}
+	check := func(r *FileRepo) {
+		t.Helper()
+		want := map[string]string{"a": ContentHash(json.RawMessage(`{"type":"insight","text":"t"}`)), "b": "", "r": ReferenceHash("x")}
+		for id, hash := range want {
+			if f, err := r.Get(ctx, "kostas", id); err != nil || f.ContentHash != hash {
+				t.Fatalf("%s: hash = %+v, %v; want %q", id, f, err, hash)
+			}
+		}
+		dup := newFav("c")
+		dup.ContentHash = want["a"]
+		var de *DuplicateError
+		if err := r.Create(ctx, "kostas", dup); !errors.As(err, &de) || de.ExistingID != "a" {
+			t.Fatalf("want duplicate of a, got %v", err)
+		}
+	}
+
+	r, err := OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	check(r)
+	if got := r.HashCollisions(); len(got) != 1 || got[0] != (HashCollision{UserID: "kostas", FavID: "b", ExistingID: "a"}) {
+		t.Fatalf("collisions = %+v", got)
+	}
+	pending := r.pending
+	r.Close()
+
+	r, err = OpenFileRepo(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	check(r)
+	if r.pending != pending || len(r.HashCollisions()) != 0 {
+		t.Fatalf("second open appended %d records and found collisions %+v", r.pending-pending, r.HashCollisions())
+	}
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"strconv"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// ContentHash returns the SHA-256 of the canonical form of a validated asset payload:
+// object keys sorted, insignificant whitespace dropped and numbers re-encoded, so the
+// same asset hashes alike however it was written. The top-level description is left
+// out, as it is the favourite's own note rather than part of the asset. Backends
+// recompute it for favourites stored before deduplication (see backfillHashes).
+func ContentHash(raw json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return ""
+	}
+	if obj, ok := v.(map[string]any); ok {
+		delete(obj, "description")
+	}
+	canonical, err := json.Marshal(canonicalNumbers(v))
+	if err != nil {
+		return ""
+	}
+	return hashOf("asset:", canonical)
+}
+
+// canonicalNumbers replaces every json.Number in v, decoded with UseNumber, by the
+// float64 it denotes when that float64 is exactly the number as written (1.50 and 1.5
+// alike), as a plain float64 decode would. Numbers beyond float64 precision, such as
+// integers above 2^53, keep their exact value so that different ones hash apart.
+func canonicalNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = canonicalNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = canonicalNumbers(e)
+		}
+	case json.Number:
+		exact, ok := new(big.Rat).SetString(v.String())
+		if !ok {
+			return v
+		}
+		if f, err := v.Float64(); err == nil {
+			if short, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64)); ok && short.Cmp(exact) == 0 {
+				return f
+			}
+		}
+		if exact.IsInt() {
+			return json.Number(exact.Num().String())
+		}
+	}
+	return v
+}
+
+// ReferenceHash is ContentHash for a favourite referencing the catalog asset assetID,
+// so a user cannot reference the same catalog asset twice either.
+func ReferenceHash(assetID string) string {
+	return hashOf("ref:", []byte(assetID))
+}
+
+// hashOf hashes b under a prefix that keeps embedded and referenced content apart.
+func hashOf(prefix string, b []byte) string {
+	sum := sha256.Sum256(append([]byte(prefix), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashOfFavourite is the content hash the service gives f.
+func hashOfFavourite(f *models.Favourite) string {
+	if f.AssetID != "" {
+		return ReferenceHash(f.AssetID)
+	}
+	return ContentHash(f.Asset)
+}
+
+// HashCollision names a favourite left without a content hash by a backfill because an
+// older favourite of the same user, ExistingID, holds the same content.
+type HashCollision struct {
+	UserID     string
+	FavID      string
+	ExistingID string
+}
+
+// HashCollisionReporter is implemented by backends that backfill content hashes when
+// opened. HashCollisions lists the duplicates that backfill found, so the caller can
+// report them through its own logger.
+type HashCollisionReporter interface {
+	HashCollisions() []HashCollision
+}
+
+// backfillHashes computes the content hashes of favourites stored before deduplication.
+// Per user, oldest first, each gets its hash unless another favourite of the user holds
+// it already (holder reports existing hashes). Such duplicates keep an empty hash and stay
+// exempt, like favourites stored with duplicates allowed, and are returned as collisions
+// so they can be reported and cleaned up. It also returns legacy in that order, with
+// hashed copies replacing the favourites that got one.
+func backfillHashes(legacy []stored, holder func(userID, hash string) string) ([]stored, []HashCollision) {
+	slices.SortFunc(legacy, func(a, b stored) int {
+		return cmp.Or(cmp.Compare(a.userID, b.userID), a.fav.CreatedAt.Compare(b.fav.CreatedAt), cmp.Compare(a.fav.ID, b.fav.ID))
+	})
+	var collisions []HashCollision
+	claimed := make(map[[2]string]string) // (userID, hash) -> favID, for hashes given here
+	for i, l := range legacy {
+		hash := hashOfFavourite(l.fav)
+		if hash == "" {
+			continue
+		}
+		existing := claimed[[2]string{l.userID, hash}]
+		if existing == "" {
+			existing = holder(l.userID, hash)
+		}
+		if existing != "" {
+			collisions = append(collisions, HashCollision{UserID: l.userID, FavID: l.fav.ID, ExistingID: existing})
+			continue
+		}
+		claimed[[2]string{l.userID, hash}] = l.fav.ID
+		c := *l.fav
+		c.ContentHash = hash
+		legacy[i].fav = &c
+	}
+	return legacy, collisions
+}
@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestContentHash checks which spellings of an asset share a hash: key order, white
+// space, the description and the notation of a number do not matter, while numbers that
+// differ only beyond float64 precision still tell assets apart.
+func TestContentHash(t *testing.T) {
+	same := [][2]string{
+		{`{"type":"chart","data":[1.5,2]}`, `{ "data": [1.50, 2.0], "type": "chart", "description": "mine" }`},
+		{`{"type":"chart","data":[0.1,100]}`, `{"type":"chart","data":[1e-1,1E2]}`},
+	}
+	for _, p := range same {
+		if ContentHash(json.RawMessage(p[0])) != ContentHash(json.RawMessage(p[1])) {
+			t.Errorf("%s and %s should hash alike", p[0], p[1])
+		}
+	}
+	differ := [][2]string{
+		{`{"id":9007199254740993}`, `{"id":9007199254740992}`},
+		{`{"v":0.10000000000000000001}`, `{"v":0.1}`},
+		{`{"type":"chart","data":[1,2]}`, `{"type":"chart","data":[2,1]}`},
+	}
+	for _, p := range differ {
+		if ContentHash(json.RawMessage(p[0])) == ContentHash(json.RawMessage(p[1])) {
+			t.Errorf("%s and %s should hash apart", p[0], p[1])
+		}
+	}
+}
@@ -1,62 +1,307 @@
 package repo
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"sync"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/KostasDasios/platform-go-challenge/internal/models"
 )
 
 var ErrNotFound = errors.New("not found")
 
+// ErrVersionMismatch is returned by conditional writes when the stored version differs
+// from the one the caller expected (i.e. someone else modified the favourite first).
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrDuplicate is matched by the *DuplicateError returned when a write would give a user
+// two favourites with the same non-empty ContentHash.
+var ErrDuplicate = errors.New("duplicate favourite")
+
+// DuplicateError names the favourite that already holds the content.
+type DuplicateError struct {
+	ExistingID string
+}
+
+func (e *DuplicateError) Error() string { return "duplicate of favourite " + e.ExistingID }
+
+func (e *DuplicateError) Is(target error) bool { return target == ErrDuplicate }
+
+// Repository abstracts favourites storage. Every method takes the request context;
+// implementations must stop work and return ctx.Err() once it is cancelled or its deadline passes.
+// Writes keep ContentHash unique per user: a favourite whose non-empty hash is already held
+// by another of the user's favourites is rejected with a *DuplicateError.
 type Repository interface {
-	List(userID string) ([]*models.Favourite, error)
-	Create(userID string, fav *models.Favourite) error
-	Get(userID, favID string) (*models.Favourite, error)
-	UpdateDescription(userID, favID, desc string) (*models.Favourite, error)
-	Delete(userID, favID string) error
+	List(ctx context.Context, userID string, q ListQuery) (*ListPage, error)
+	Create(ctx context.Context, userID string, fav *models.Favourite) error
+	Get(ctx context.Context, userID, favID string) (*models.Favourite, error)
+	Update(ctx context.Context, userID, favID string, u Update) (*models.Favourite, error)
+	// Delete removes a favourite. A non-zero ifVersion makes the delete conditional.
+	Delete(ctx context.Context, userID, favID string, ifVersion int64) error
+	// Apply runs ops in order as one all-or-nothing unit and returns the resulting
+	// favourite per op (nil for deletes). On failure nothing is written and the
+	// error is a *BatchError naming the op that failed.
+	Apply(ctx context.Context, userID string, ops []Op) ([]*models.Favourite, error)
+	// CountByType reports how many favourites are stored per asset type, across all users.
+	CountByType(ctx context.Context) (map[models.AssetType]int, error)
+	// TagCounts reports how many of the user's favourites carry each tag.
+	TagCounts(ctx context.Context, userID string) (map[string]int, error)
+	// SetReferenceSearchText replaces the search text of every favourite, across all users,
+	// that references the catalog asset assetID, and reports how many it changed. The
+	// search text is derived from the asset, so versions and update times are kept.
+	SetReferenceSearchText(ctx context.Context, assetID, searchText string) (int, error)
+}
+
+// Update describes a modification of an existing favourite. Nil fields are left unchanged;
+// ID, Type and CreatedAt are immutable. UpdatedAt is always recorded and Version bumped.
+// A non-zero IfVersion makes the write conditional: it fails with ErrVersionMismatch
+// unless the stored version equals IfVersion.
+type Update struct {
+	Description *string
+	Asset       json.RawMessage
+	SearchText  *string
+	ContentHash *string
+	Tags        []string // replaces all tags; nil leaves them unchanged
+	UpdatedAt   time.Time
+	IfVersion   int64
+}
+
+// checkVersion enforces an optional precondition on the stored version.
+func checkVersion(f *models.Favourite, ifVersion int64) error {
+	if ifVersion != 0 && f.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// apply returns a modified copy of f; the original is never mutated so readers
+// holding it (e.g. while encoding a response) are unaffected.
+func (u Update) apply(f *models.Favourite) *models.Favourite {
+	out := *f
+	out.Version++
+	if u.Description != nil {
+		out.Description = *u.Description
+	}
+	if u.Asset != nil {
+		out.Asset = u.Asset
+	}
+	if u.SearchText != nil {
+		out.SearchText = *u.SearchText
+	}
+	if u.ContentHash != nil {
+		out.ContentHash = *u.ContentHash
+	}
+	if u.Tags != nil {
+		out.Tags = nil
+		if len(u.Tags) > 0 {
+			out.Tags = slices.Clone(u.Tags)
+		}
+	}
+	at := u.UpdatedAt.UTC()
+	out.UpdatedAt = &at
+	return &out
+}
+
+// ListQuery selects one page of a user's favourites. Filters are combined with AND and
+// evaluated by the backend (so persistent stores can use their indexes); Total counts
+// all matching favourites. When After is set the page starts right after that position
+// (keyset pagination) and Offset is ignored; otherwise Offset items are skipped.
+// A Limit <= 0 returns everything.
+type ListQuery struct {
+	Limit  int
+	Offset int
+	After  *Cursor
+	Sort   SortOrder // empty means SortCreatedDesc
+
+	IDs           []string           // only these favourites (e.g. a collection's); nil means all
+	Types         []models.AssetType // any of these types; empty means all
+	Tags          []string           // all of these tags; empty means all
+	AnyTag        bool               // with Tags, match favourites carrying any of them
+	Search        string             // case-insensitive substring of description, title or text
+	CreatedAfter  time.Time          // exclusive lower bound; zero means unbounded
+	CreatedBefore time.Time          // exclusive upper bound; zero means unbounded
+}
+
+// filtered reports whether any filter beyond paging is set.
+func (q ListQuery) filtered() bool {
+	return len(q.Types) > 0 || len(q.Tags) > 0 || q.Search != "" || !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero()
+}
+
+// match reports whether f passes the query filters.
+func (q ListQuery) match(f *models.Favourite) bool {
+	if len(q.Types) > 0 && !slices.Contains(q.Types, f.Type) {
+		return false
+	}
+	if len(q.Tags) > 0 && !q.matchTags(f.Tags) {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !f.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !f.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	if q.Search != "" {
+		needle := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(f.Description), needle) && !strings.Contains(f.SearchText, needle) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTags reports whether tags satisfy the tag filter: all of q.Tags, or any of them with AnyTag.
+func (q ListQuery) matchTags(tags []string) bool {
+	has := func(t string) bool { return slices.Contains(tags, t) }
+	if q.AnyTag {
+		return slices.ContainsFunc(q.Tags, has)
+	}
+	return !slices.ContainsFunc(q.Tags, func(t string) bool { return !has(t) })
+}
+
+// ListPage is one page of favourites. Next is the cursor to pass as ListQuery.After
+// to fetch the following page; it is nil when there are no more results.
+type ListPage struct {
+	Items []*models.Favourite
+	Total int
+	Next  *Cursor
+}
+
+// HealthChecker is implemented by backends whose availability can change at runtime
+// (e.g. a database). Readiness probes use it to report real storage health.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
 }
 
 // InMemoryRepo is a thread-safe in-memory implementation intended for the assignment and unit tests.
 // It is guarded by an RWMutex; production deployments would use an external store.
+// Alongside the lookup map it keeps each user's favourites sorted in listing order,
+// so a cursor page is located by binary search instead of sorting the whole list.
 type InMemoryRepo struct {
-	mu   sync.RWMutex
-	data map[string]map[string]*models.Favourite // userID -> favID -> Favourite
+	mu     sync.RWMutex
+	data   map[string]map[string]*models.Favourite // userID -> favID -> Favourite
+	order  map[string][]*models.Favourite          // userID -> favourites, newest first
+	hashes map[string]map[string]string            // userID -> ContentHash -> favID
 }
 
 func NewInMemoryRepo() *InMemoryRepo {
-	return &InMemoryRepo{data: make(map[string]map[string]*models.Favourite)}
+	return &InMemoryRepo{
+		data:   make(map[string]map[string]*models.Favourite),
+		order:  make(map[string][]*models.Favourite),
+		hashes: make(map[string]map[string]string),
+	}
 }
 
-// List returns all favourites of a given user in deterministic order.
-// Results are sorted by creation time (newest first).
-func (r *InMemoryRepo) List(userID string) ([]*models.Favourite, error) {
+// List returns one page of a user's favourites in deterministic order.
+// The unfiltered newest-first listing is served straight from the ordered index by
+// binary search; other queries scan the user's favourites once.
+func (r *InMemoryRepo) List(ctx context.Context, userID string, q ListQuery) (*ListPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if q.Sort == "" {
+		q.Sort = SortCreatedDesc
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	m := r.data[userID]
-	out := make([]*models.Favourite, 0, len(m))
-	for _, f := range m {
-		out = append(out, f)
-	}
-	// Sort newest first for deterministic output
-    sort.Slice(out, func(i, j int) bool {
-        return out[i].CreatedAt.After(out[j].CreatedAt)
-    })
-	return out, nil
+
+	all := r.order[userID]
+	if q.IDs != nil {
+		all = r.pick(userID, q.IDs)
+	}
+	if q.filtered() || q.Sort != SortCreatedDesc {
+		matched := make([]*models.Favourite, 0, len(all))
+		for _, f := range all {
+			if q.match(f) {
+				matched = append(matched, f)
+			}
+		}
+		if q.Sort != SortCreatedDesc {
+			sort.Slice(matched, func(i, j int) bool { return q.Sort.less(matched[i], matched[j]) })
+		}
+		all = matched
+	}
+
+	start := q.Offset
+	if q.After != nil {
+		start = sort.Search(len(all), func(i int) bool { return !q.After.covers(all[i]) })
+	}
+	start = min(max(start, 0), len(all))
+	end := len(all)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(all))
+	}
+
+	page := &ListPage{Items: make([]*models.Favourite, end-start), Total: len(all)}
+	copy(page.Items, all[start:end])
+	if end < len(all) && end > start {
+		page.Next = CursorOf(all[end-1], q.Sort)
+	}
+	return page, nil
+}
+
+// pick returns the user's favourites among ids, newest first. Callers must hold the lock.
+func (r *InMemoryRepo) pick(userID string, ids []string) []*models.Favourite {
+	out := make([]*models.Favourite, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if f, ok := r.data[userID][id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return newer(out[i], out[j]) })
+	return out
 }
 
-func (r *InMemoryRepo) Create(userID string, fav *models.Favourite) error {
+func (r *InMemoryRepo) Create(ctx context.Context, userID string, fav *models.Favourite) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.data[userID] == nil {
-		r.data[userID] = make(map[string]*models.Favourite)
+	if err := r.checkUnique(userID, fav); err != nil {
+		return err
 	}
-	r.data[userID][fav.ID] = fav
+	r.store(userID, fav)
 	return nil
 }
 
-func (r *InMemoryRepo) Get(userID, favID string) (*models.Favourite, error) {
+// unique is checkUnique under the read lock, for writers that serialise on their own lock.
+func (r *InMemoryRepo) unique(userID string, fav *models.Favourite) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkUnique(userID, fav)
+}
+
+// owner returns the ID of the user's favourite holding hash, if any.
+func (r *InMemoryRepo) owner(userID, hash string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hashes[userID][hash]
+}
+
+// checkUnique rejects fav if another of the user's favourites holds its content hash.
+// Callers must hold the lock.
+func (r *InMemoryRepo) checkUnique(userID string, fav *models.Favourite) error {
+	if fav.ContentHash == "" {
+		return nil
+	}
+	if id, ok := r.hashes[userID][fav.ContentHash]; ok && id != fav.ID {
+		return &DuplicateError{ExistingID: id}
+	}
+	return nil
+}
+
+func (r *InMemoryRepo) Get(ctx context.Context, userID, favID string) (*models.Favourite, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	m := r.data[userID]
@@ -70,31 +315,204 @@ func (r *InMemoryRepo) Get(userID, favID string) (*models.Favourite, error) {
 	return f, nil
 }
 
-func (r *InMemoryRepo) UpdateDescription(userID, favID, desc string) (*models.Favourite, error) {
+func (r *InMemoryRepo) Update(ctx context.Context, userID, favID string, u Update) (*models.Favourite, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	m := r.data[userID]
-	if m == nil {
-		return nil, ErrNotFound
-	}
-	f, ok := m[favID]
+	f, ok := r.data[userID][favID]
 	if !ok {
 		return nil, ErrNotFound
 	}
-	f.Description = desc
-	return f, nil
+	if err := checkVersion(f, u.IfVersion); err != nil {
+		return nil, err
+	}
+	upd := u.apply(f)
+	if err := r.checkUnique(userID, upd); err != nil {
+		return nil, err
+	}
+	r.store(userID, upd)
+	return upd, nil
 }
 
-func (r *InMemoryRepo) Delete(userID, favID string) error {
+func (r *InMemoryRepo) Delete(ctx context.Context, userID, favID string, ifVersion int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	m := r.data[userID]
 	if m == nil {
 		return ErrNotFound
 	}
-	if _, ok := m[favID]; !ok {
+	f, ok := m[favID]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := checkVersion(f, ifVersion); err != nil {
+		return err
+	}
 	delete(m, favID)
+	r.unindex(userID, f)
 	return nil
 }
+
+func (r *InMemoryRepo) Apply(ctx context.Context, userID string, ops []Op) ([]*models.Favourite, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out, err := plan(ops, func(favID string) *models.Favourite { return r.data[userID][favID] },
+		func(hash string) string { return r.hashes[userID][hash] })
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if out[i] != nil {
+			r.store(userID, out[i])
+		} else if f, ok := r.data[userID][op.FavID]; ok {
+			delete(r.data[userID], op.FavID)
+			r.unindex(userID, f)
+		}
+	}
+	return out, nil
+}
+
+// put stores fav under userID, replacing any favourite with the same ID, without
+// checking uniqueness. It lets persistent implementations rebuild the index from disk.
+func (r *InMemoryRepo) put(userID string, fav *models.Favourite) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(userID, fav)
+}
+
+// store is put without locking. Callers must hold the write lock.
+func (r *InMemoryRepo) store(userID string, fav *models.Favourite) {
+	if r.data[userID] == nil {
+		r.data[userID] = make(map[string]*models.Favourite)
+	}
+	if old, exists := r.data[userID][fav.ID]; exists {
+		r.unindex(userID, old)
+	}
+	r.data[userID][fav.ID] = fav
+	if fav.ContentHash != "" {
+		if r.hashes[userID] == nil {
+			r.hashes[userID] = make(map[string]string)
+		}
+		r.hashes[userID][fav.ContentHash] = fav.ID
+	}
+
+	list := r.order[userID]
+	i := sort.Search(len(list), func(i int) bool { return newer(fav, list[i]) })
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = fav
+	r.order[userID] = list
+}
+
+// each calls fn for every stored favourite while holding the read lock.
+func (r *InMemoryRepo) each(fn func(userID string, fav *models.Favourite)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for userID, m := range r.data {
+		for _, f := range m {
+			fn(userID, f)
+		}
+	}
+}
+
+// remove deletes a favourite if present; removing a missing entry is a no-op
+// so that log replay stays idempotent.
+func (r *InMemoryRepo) remove(userID, favID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m := r.data[userID]; m != nil {
+		if f, ok := m[favID]; ok {
+			delete(m, favID)
+			r.unindex(userID, f)
+		}
+	}
+}
+
+// unindex drops f from the user's ordered slice and hash index. Callers must hold the write lock.
+func (r *InMemoryRepo) unindex(userID string, f *models.Favourite) {
+	if f.ContentHash != "" && r.hashes[userID][f.ContentHash] == f.ID {
+		delete(r.hashes[userID], f.ContentHash)
+	}
+	list := r.order[userID]
+	i := sort.Search(len(list), func(i int) bool { return !newer(list[i], f) })
+	if i < len(list) && list[i].ID == f.ID {
+		r.order[userID] = append(list[:i], list[i+1:]...)
+	}
+}
+
+// CountByType scans every user's favourites under the read lock.
+func (r *InMemoryRepo) CountByType(ctx context.Context) (map[models.AssetType]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	counts := make(map[models.AssetType]int)
+	for _, favs := range r.order {
+		for _, f := range favs {
+			counts[f.Type]++
+		}
+	}
+	return counts, nil
+}
+
+// SetReferenceSearchText scans every user's favourites under the write lock and stores
+// modified copies of the references to assetID.
+func (r *InMemoryRepo) SetReferenceSearchText(ctx context.Context, assetID, searchText string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refs := r.references(assetID, searchText)
+	for _, ref := range refs {
+		r.store(ref.userID, ref.fav)
+	}
+	return len(refs), nil
+}
+
+// stored is a favourite and the user it belongs to.
+type stored struct {
+	userID string
+	fav    *models.Favourite
+}
+
+// references returns copies of the favourites referencing assetID whose search text
+// differs from searchText, with it set. Callers must hold the lock.
+func (r *InMemoryRepo) references(assetID, searchText string) []stored {
+	var out []stored
+	for userID, m := range r.data {
+		for _, f := range m {
+			if f.AssetID == assetID && f.SearchText != searchText {
+				c := *f
+				c.SearchText = searchText
+				out = append(out, stored{userID, &c})
+			}
+		}
+	}
+	return out
+}
+
+// TagCounts scans the user's favourites under the read lock.
+func (r *InMemoryRepo) TagCounts(ctx context.Context, userID string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, f := range r.order[userID] {
+		for _, t := range f.Tags {
+			counts[t]++
+		}
+	}
+	return counts, nil
+}
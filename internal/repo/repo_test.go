@@ -0,0 +1,404 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// backends returns a fresh instance of every Repository implementation so that
+// behaviour shared through the interface is verified once for all of them.
+func backends(t *testing.T) map[string]Repository {
+	t.Helper()
+	file, err := OpenFileRepo(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("open file repo: %v", err)
+	}
+	t.Cleanup(func() { file.Close() })
+	sqlite, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "favourites.db"))
+	if err != nil {
+		t.Fatalf("open sqlite repo: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Repository{"memory": NewInMemoryRepo(), "file": file, "sqlite": sqlite}
+}
+
+// TestRepository_CursorPaging walks all pages with a cursor while new favourites are
+// inserted between requests: every original item must be returned exactly once.
+func TestRepository_CursorPaging(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Second)
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			// 7 items; pairs share a timestamp to exercise the id tie-breaker
+			for i := 0; i < 7; i++ {
+				f := newFav(fmt.Sprintf("f%d", i))
+				f.CreatedAt = base.Add(time.Duration(i/2) * time.Second)
+				if err := r.Create(ctx, "kostas", f); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+
+			seen := map[string]bool{}
+			var order []string
+			q := ListQuery{Limit: 3}
+			for pages := 0; ; pages++ {
+				page, err := r.List(ctx, "kostas", q)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				for _, f := range page.Items {
+					if seen[f.ID] {
+						t.Fatalf("item %s returned twice", f.ID)
+					}
+					seen[f.ID] = true
+					order = append(order, f.ID)
+				}
+				// a newer insert must not shift the remaining pages
+				nf := newFav(fmt.Sprintf("new%d", pages))
+				nf.CreatedAt = base.Add(time.Hour)
+				if err := r.Create(ctx, "kostas", nf); err != nil {
+					t.Fatalf("create during paging: %v", err)
+				}
+				if page.Next == nil {
+					break
+				}
+				c, err := DecodeCursor(page.Next.Encode())
+				if err != nil {
+					t.Fatalf("cursor round-trip: %v", err)
+				}
+				q.After = c
+			}
+
+			want := []string{"f6", "f5", "f4", "f3", "f2", "f1", "f0"}
+			if fmt.Sprint(order) != fmt.Sprint(want) {
+				t.Fatalf("order = %v, want %v", order, want)
+			}
+		})
+	}
+}
+
+// TestRepository_OffsetPaging keeps the legacy limit/offset contract working.
+func TestRepository_OffsetPaging(t *testing.T) {
+	base := time.Now().UTC()
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				f := newFav(fmt.Sprintf("f%d", i))
+				f.CreatedAt = base.Add(time.Duration(i) * time.Second)
+				r.Create(ctx, "kostas", f)
+			}
+			page, err := r.List(ctx, "kostas", ListQuery{Limit: 2, Offset: 2})
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if page.Total != 5 || len(page.Items) != 2 || page.Items[0].ID != "f2" {
+				t.Fatalf("unexpected page: total=%d items=%v", page.Total, page.Items)
+			}
+			if page.Next == nil || page.Next.ID != "f1" {
+				t.Fatalf("expected next cursor at f1, got %+v", page.Next)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor_RejectsGarbage(t *testing.T) {
+	for _, s := range []string{"!!", "Zm9v", "", "cG9zaXRpb258YXwz"} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+// TestRepository_UpdateKeepsIdentity replaces the asset and checks immutable fields survive.
+func TestRepository_UpdateKeepsIdentity(t *testing.T) {
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			f := newFav("a")
+			if err := r.Create(ctx, "kostas", f); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			at := time.Now().UTC()
+			asset := []byte(`{"type":"insight","text":"changed"}`)
+			if _, err := r.Update(ctx, "kostas", "a", Update{Asset: asset, UpdatedAt: at}); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			got, err := r.Get(ctx, "kostas", "a")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if string(got.Asset) != string(asset) || got.Description != f.Description {
+				t.Fatalf("unexpected payload after update: %+v", got)
+			}
+			if !got.CreatedAt.Equal(f.CreatedAt) || got.UpdatedAt == nil || !got.UpdatedAt.Equal(at) {
+				t.Fatalf("timestamps not preserved: created=%v updated=%v", got.CreatedAt, got.UpdatedAt)
+			}
+			if _, err := r.Update(ctx, "kostas", "missing", Update{UpdatedAt: at}); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("want ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// TestRepository_ConditionalWrites checks version bumps and compare-and-swap semantics.
+func TestRepository_ConditionalWrites(t *testing.T) {
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := r.Create(ctx, "kostas", newFav("a")); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			desc := "v2"
+			upd, err := r.Update(ctx, "kostas", "a", Update{Description: &desc, UpdatedAt: time.Now(), IfVersion: 1})
+			if err != nil || upd.Version != 2 {
+				t.Fatalf("conditional update on matching version: %+v %v", upd, err)
+			}
+			// a writer still holding version 1 must lose
+			if _, err := r.Update(ctx, "kostas", "a", Update{Description: &desc, UpdatedAt: time.Now(), IfVersion: 1}); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale update: want ErrVersionMismatch, got %v", err)
+			}
+			if err := r.Delete(ctx, "kostas", "a", 1); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("stale delete: want ErrVersionMismatch, got %v", err)
+			}
+			if err := r.Delete(ctx, "kostas", "missing", 1); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("delete missing: want ErrNotFound, got %v", err)
+			}
+			if err := r.Delete(ctx, "kostas", "a", 2); err != nil {
+				t.Fatalf("delete with current version: %v", err)
+			}
+		})
+	}
+}
+
+// TestRepository_FiltersAndSort checks type/search/date filters and alternative sort
+// orders, including keyset paging through a filtered description-ordered listing.
+func TestRepository_FiltersAndSort(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Second)
+	seed := []struct {
+		id, desc, search string
+		typ              models.AssetType
+		tags             []string
+	}{
+		{"a", "Sales", "q1 revenue", models.AssetChart, []string{"q1", "sales"}},
+		{"b", "churn", "", models.AssetAudience, nil},
+		{"c", "Beta", "revenue grew", models.AssetInsight, []string{"sales"}},
+		{"d", "alpha", "", models.AssetChart, []string{"q1"}},
+		{"e", "Revenue notes", "", models.AssetInsight, []string{"notes", "q1", "sales"}},
+	}
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, s := range seed {
+				f := newFav(s.id)
+				f.Type, f.Description, f.SearchText, f.Tags = s.typ, s.desc, s.search, s.tags
+				f.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+				if err := r.Create(ctx, "kostas", f); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+			ids := func(q ListQuery) string {
+				t.Helper()
+				page, err := r.List(ctx, "kostas", q)
+				if err != nil {
+					t.Fatalf("list %+v: %v", q, err)
+				}
+				var out []string
+				for _, f := range page.Items {
+					out = append(out, f.ID)
+				}
+				return fmt.Sprintf("%v/%d", out, page.Total)
+			}
+			cases := []struct {
+				q    ListQuery
+				want string
+			}{
+				{ListQuery{Types: []models.AssetType{models.AssetChart}}, "[d a]/2"},
+				{ListQuery{Types: []models.AssetType{models.AssetChart, models.AssetInsight}, Limit: 2}, "[e d]/4"},
+				{ListQuery{Search: "REVENUE"}, "[e c a]/3"},
+				{ListQuery{CreatedAfter: base, CreatedBefore: base.Add(3 * time.Minute)}, "[c b]/2"},
+				{ListQuery{Sort: SortCreatedAsc, Limit: 2}, "[a b]/5"},
+				{ListQuery{Sort: SortDescription}, "[c e a d b]/5"},
+				{ListQuery{Search: "revenue", Types: []models.AssetType{models.AssetInsight}, Sort: SortCreatedAsc}, "[c e]/2"},
+				{ListQuery{IDs: []string{"a", "missing", "d", "e"}, Types: []models.AssetType{models.AssetChart, models.AssetInsight}}, "[e d a]/3"},
+				{ListQuery{IDs: []string{}}, "[]/0"},
+				{ListQuery{Tags: []string{"q1", "sales"}}, "[e a]/2"},
+				{ListQuery{Tags: []string{"notes", "q1"}, AnyTag: true}, "[e d a]/3"},
+				{ListQuery{Tags: []string{"sales"}, Search: "revenue", Sort: SortCreatedAsc}, "[a c e]/3"},
+				{ListQuery{Tags: []string{"missing"}}, "[]/0"},
+			}
+			for _, c := range cases {
+				if got := ids(c.q); got != c.want {
+					t.Errorf("list %+v = %s, want %s", c.q, got, c.want)
+				}
+			}
+
+			// page through a filtered listing ordered by description
+			q := ListQuery{Sort: SortDescription, Types: []models.AssetType{models.AssetChart, models.AssetInsight}, Limit: 1}
+			var order []string
+			for {
+				page, err := r.List(ctx, "kostas", q)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				for _, f := range page.Items {
+					order = append(order, f.ID)
+				}
+				if page.Next == nil {
+					break
+				}
+				c, err := DecodeCursor(page.Next.Encode())
+				if err != nil || c.Sort != SortDescription {
+					t.Fatalf("cursor round-trip: %+v %v", c, err)
+				}
+				q.After = c
+			}
+			if fmt.Sprint(order) != "[c e a d]" {
+				t.Fatalf("description paging = %v", order)
+			}
+
+			counts, err := r.CountByType(ctx)
+			if err != nil || fmt.Sprint(counts) != "map[audience:1 chart:2 insight:2]" {
+				t.Fatalf("count by type = %v, %v", counts, err)
+			}
+
+			tags, err := r.TagCounts(ctx, "kostas")
+			if err != nil || fmt.Sprint(tags) != "map[notes:1 q1:3 sales:3]" {
+				t.Fatalf("tag counts = %v, %v", tags, err)
+			}
+			if f, err := r.Update(ctx, "kostas", "e", Update{Tags: []string{}, UpdatedAt: time.Now()}); err != nil || f.Tags != nil {
+				t.Fatalf("clear tags = %+v, %v", f, err)
+			}
+			if tags, _ = r.TagCounts(ctx, "kostas"); fmt.Sprint(tags) != "map[q1:2 sales:2]" {
+				t.Fatalf("tag counts after clearing = %v", tags)
+			}
+			if tags, _ = r.TagCounts(ctx, "other"); len(tags) != 0 {
+				t.Fatalf("another user's tag counts = %v", tags)
+			}
+		})
+	}
+}
+
+// TestRepository_ApplyBatch checks that a batch sees its own earlier writes and that a
+// failing operation leaves the stored state untouched.
+func TestRepository_ApplyBatch(t *testing.T) {
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := r.Create(ctx, "kostas", newFav("a")); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			out, err := r.Apply(ctx, "kostas", []Op{
+				{Kind: OpCreate, Fav: newFav("b")},
+				{Kind: OpUpdate, FavID: "a", Update: Update{Description: strPtr("one"), UpdatedAt: time.Now(), IfVersion: 1}},
+				{Kind: OpUpdate, FavID: "a", Update: Update{Description: strPtr("two"), UpdatedAt: time.Now(), IfVersion: 2}},
+				{Kind: OpDelete, FavID: "b", IfVersion: 1},
+			})
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if len(out) != 4 || out[0].ID != "b" || out[2].Version != 3 || out[3] != nil {
+				t.Fatalf("unexpected results: %+v", out)
+			}
+			if got, err := r.Get(ctx, "kostas", "a"); err != nil || got.Description != "two" || got.Version != 3 {
+				t.Fatalf("after batch: %+v %v", got, err)
+			}
+			if _, err := r.Get(ctx, "kostas", "b"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("b should be deleted by the batch, got %v", err)
+			}
+
+			_, err = r.Apply(ctx, "kostas", []Op{
+				{Kind: OpCreate, Fav: newFav("c")},
+				{Kind: OpDelete, FavID: "a"},
+				{Kind: OpUpdate, FavID: "a", Update: Update{Description: strPtr("x"), UpdatedAt: time.Now()}},
+			})
+			var be *BatchError
+			if !errors.As(err, &be) || be.Index != 2 || !errors.Is(err, ErrNotFound) {
+				t.Fatalf("want BatchError at 2 wrapping ErrNotFound, got %v", err)
+			}
+			page, _ := r.List(ctx, "kostas", ListQuery{})
+			if len(page.Items) != 1 || page.Items[0].ID != "a" || page.Items[0].Version != 3 {
+				t.Fatalf("failed batch must not write anything, got %+v", page.Items)
+			}
+		})
+	}
+}
+
+// TestRepository_UniqueContent checks that every backend keeps content hashes unique
+// per user, on single writes and within batches, while unhashed favourites are exempt.
+func TestRepository_UniqueContent(t *testing.T) {
+	hashed := func(id, hash string) *models.Favourite {
+		f := newFav(id)
+		f.ContentHash = hash
+		return f
+	}
+	isDup := func(err error, existing string) bool {
+		var de *DuplicateError
+		return errors.Is(err, ErrDuplicate) && errors.As(err, &de) && de.ExistingID == existing
+	}
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, f := range []*models.Favourite{hashed("a", "h1"), newFav("u1"), newFav("u2"), hashed("o", "h1")} {
+				user := "kostas"
+				if f.ID == "o" {
+					user = "maria" // the same content for another user is fine
+				}
+				if err := r.Create(ctx, user, f); err != nil {
+					t.Fatalf("create %s: %v", f.ID, err)
+				}
+			}
+			if err := r.Create(ctx, "kostas", hashed("b", "h1")); !isDup(err, "a") {
+				t.Fatalf("duplicate create: got %v", err)
+			}
+			if _, err := r.Update(ctx, "kostas", "u1", Update{ContentHash: strPtr("h1"), UpdatedAt: time.Now()}); !isDup(err, "a") {
+				t.Fatalf("update onto taken hash: got %v", err)
+			}
+			if _, err := r.Update(ctx, "kostas", "a", Update{ContentHash: strPtr("h1"), UpdatedAt: time.Now()}); err != nil {
+				t.Fatalf("update keeping own hash: %v", err)
+			}
+
+			// a delete earlier in the batch frees the hash; a second claim within it does not pass
+			if _, err := r.Apply(ctx, "kostas", []Op{{Kind: OpDelete, FavID: "a"}, {Kind: OpCreate, Fav: hashed("c", "h1")}}); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			_, err := r.Apply(ctx, "kostas", []Op{{Kind: OpCreate, Fav: hashed("d", "h2")}, {Kind: OpCreate, Fav: hashed("e", "h2")}})
+			var be *BatchError
+			if !errors.As(err, &be) || be.Index != 1 || !isDup(err, "d") {
+				t.Fatalf("want BatchError at 1 for duplicate of d, got %v", err)
+			}
+			if err := r.Create(ctx, "kostas", hashed("f", "h1")); !isDup(err, "c") {
+				t.Fatalf("duplicate of batch-created favourite: got %v", err)
+			}
+		})
+	}
+}
+
+// TestRepository_ReferenceSearchText checks that every backend refreshes the search text
+// of all users' references to an asset, and only theirs, without touching versions.
+func TestRepository_ReferenceSearchText(t *testing.T) {
+	ref := func(id, assetID string) *models.Favourite {
+		f := newFav(id)
+		f.Asset, f.AssetID, f.SearchText = nil, assetID, "revenue"
+		return f
+	}
+	for name, r := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for user, f := range map[string]*models.Favourite{"kostas": ref("k", "a1"), "maria": ref("m", "a1"), "nikos": ref("o", "a2")} {
+				if err := r.Create(ctx, user, f); err != nil {
+					t.Fatalf("create %s: %v", f.ID, err)
+				}
+			}
+			if n, err := r.SetReferenceSearchText(ctx, "a1", "costs"); err != nil || n != 2 {
+				t.Fatalf("SetReferenceSearchText = %d, %v; want 2", n, err)
+			}
+			for user, want := range map[string]string{"kostas": "k", "maria": "m", "nikos": ""} {
+				page, err := r.List(ctx, user, ListQuery{Search: "costs"})
+				if err != nil || page.Total != len(want) || (want != "" && (page.Items[0].ID != want || page.Items[0].Version != 1)) {
+					t.Fatalf("%s: search after refresh = %+v, %v", user, page, err)
+				}
+			}
+			if n, err := r.SetReferenceSearchText(ctx, "a1", "costs"); err != nil || n != 0 {
+				t.Fatalf("unchanged refresh = %d, %v; want 0", n, err)
+			}
+		})
+	}
+}
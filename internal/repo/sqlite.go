@@ -0,0 +1,604 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3" // also registers the "sqlite3" driver
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// migrations are applied in order at startup; each entry's index+1 is its schema version.
+// Never edit an applied migration: append a new one instead.
+var migrations = []string{
+	// v1: favourites table keyed by (user_id, id) with a listing index.
+	`CREATE TABLE favourites (
+		user_id     TEXT    NOT NULL,
+		id          TEXT    NOT NULL,
+		type        TEXT    NOT NULL,
+		description TEXT    NOT NULL DEFAULT '',
+		asset       BLOB    NOT NULL,
+		created_at  INTEGER NOT NULL, -- unix nanoseconds, UTC
+		PRIMARY KEY (user_id, id)
+	);
+	CREATE INDEX idx_favourites_user_created ON favourites (user_id, created_at);`,
+
+	// v2: include the id tie-breaker so keyset pages are served straight from the index.
+	`CREATE INDEX idx_favourites_user_created_id ON favourites (user_id, created_at DESC, id DESC);
+	DROP INDEX idx_favourites_user_created;`,
+
+	// v3: last modification time (unix nanoseconds, NULL until first update).
+	`ALTER TABLE favourites ADD COLUMN updated_at INTEGER;`,
+
+	// v4: optimistic concurrency control; bumped by every mutation.
+	`ALTER TABLE favourites ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+
+	// v5: list filters. search_text mirrors the service's derived search field and is
+	// backfilled from the stored JSON; the indexes serve type filters and description sort.
+	`ALTER TABLE favourites ADD COLUMN search_text TEXT NOT NULL DEFAULT '';
+	UPDATE favourites SET search_text = lower(CASE type
+		WHEN 'chart'   THEN COALESCE(json_extract(asset, '$.title'), '')
+		WHEN 'insight' THEN COALESCE(json_extract(asset, '$.text'), '')
+		ELSE '' END);
+	CREATE INDEX idx_favourites_user_type_created ON favourites (user_id, type, created_at DESC, id DESC);
+	CREATE INDEX idx_favourites_user_description ON favourites (user_id, description, id);`,
+
+	// v6: shared asset catalog. Favourites may reference a catalog asset by asset_id
+	// (empty for embedded assets) and then store an empty asset blob. There is no
+	// foreign key: deleting an asset leaves its favourites with a dangling reference.
+	`CREATE TABLE assets (
+		id          TEXT    NOT NULL PRIMARY KEY,
+		type        TEXT    NOT NULL,
+		description TEXT    NOT NULL DEFAULT '',
+		data        BLOB    NOT NULL,
+		created_at  INTEGER NOT NULL, -- unix nanoseconds, UTC
+		updated_at  INTEGER,
+		version     INTEGER NOT NULL DEFAULT 1
+	);
+	CREATE INDEX idx_assets_created_id ON assets (created_at DESC, id DESC);
+	ALTER TABLE favourites ADD COLUMN asset_id TEXT NOT NULL DEFAULT '';`,
+
+	// v7: per-user deduplication. Existing rows get their hash in v11.
+	`ALTER TABLE favourites ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX idx_favourites_user_content ON favourites (user_id, content_hash) WHERE content_hash != '';`,
+
+	// v8: collections. Members are kept in collection_items with their manual position;
+	// they go with their collection but are not tied to the favourites table, whose rows
+	// the service forgets from collections itself.
+	`CREATE TABLE collections (
+		user_id     TEXT    NOT NULL,
+		id          TEXT    NOT NULL,
+		name        TEXT    NOT NULL,
+		created_at  INTEGER NOT NULL, -- unix nanoseconds, UTC
+		updated_at  INTEGER,
+		version     INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (user_id, id)
+	);
+	CREATE TABLE collection_items (
+		user_id       TEXT    NOT NULL,
+		collection_id TEXT    NOT NULL,
+		fav_id        TEXT    NOT NULL,
+		position      INTEGER NOT NULL,
+		PRIMARY KEY (user_id, collection_id, fav_id),
+		FOREIGN KEY (user_id, collection_id) REFERENCES collections (user_id, id) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_collection_items_fav ON collection_items (user_id, fav_id);`,
+
+	// v9: tags, a JSON array of strings. Tag filters and counts read it with json_each
+	// within one user's rows, which the (user_id, ...) indexes already narrow down.
+	`ALTER TABLE favourites ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';`,
+
+	// v10: finds the favourites referencing an asset when its search text changes.
+	`CREATE INDEX idx_favourites_asset ON favourites (asset_id);`,
+
+	// v11: content hashes of the rows stored before v7, computed in Go by backfillHashes.
+	``,
+}
+
+// migrationSteps run in the transaction of the migration with the same version, after its
+// SQL, for changes that SQL alone cannot make.
+var migrationSteps = map[int]func(r *SQLiteRepo, tx *sql.Tx) error{
+	11: (*SQLiteRepo).backfillHashes,
+}
+
+// SQLiteRepo stores favourites in an embedded SQLite database so they can be
+// queried and backed up with standard tooling.
+type SQLiteRepo struct {
+	db         *sql.DB
+	collisions []HashCollision // found by the content hash backfill (v11)
+}
+
+// OpenSQLiteRepo opens (or creates) the database at path and applies pending migrations.
+func OpenSQLiteRepo(path string) (*SQLiteRepo, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create db dir: %w", err)
+		}
+	}
+	// WAL journaling lets readers proceed while a writer commits; busy_timeout
+	// makes concurrent writers wait instead of failing with SQLITE_BUSY.
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	r := &SQLiteRepo{db: db}
+	if err := r.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// migrate brings the schema up to the latest version, one transaction per step.
+func (r *SQLiteRepo) migrate() error {
+	if _, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var current int
+	if err := r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema v%d is newer than supported v%d", current, len(migrations))
+	}
+	for v := current + 1; v <= len(migrations); v++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		if migrations[v-1] != "" {
+			if _, err := tx.Exec(migrations[v-1]); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("apply migration v%d: %w", v, err)
+			}
+		}
+		if step := migrationSteps[v]; step != nil {
+			if err := step(r, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("apply migration v%d: %w", v, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, v, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration v%d: %w", v, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration v%d: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// backfillHashes gives the favourites without a content hash theirs, with the duplicate
+// policy of backfillHashes, and keeps the collisions for HashCollisions. Rows stored with
+// duplicates allowed before this step are indistinguishable from older ones and are
+// treated alike.
+func (r *SQLiteRepo) backfillHashes(tx *sql.Tx) error {
+	holders := make(map[[2]string]string)
+	var legacy []stored
+	rows, err := tx.Query(`SELECT user_id, id, asset, asset_id, created_at, content_hash FROM favourites`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userID, hash string
+			f            models.Favourite
+			asset        []byte
+			created      int64
+		)
+		if err := rows.Scan(&userID, &f.ID, &asset, &f.AssetID, &created, &hash); err != nil {
+			return err
+		}
+		if hash != "" {
+			holders[[2]string{userID, hash}] = f.ID
+			continue
+		}
+		f.Asset, f.CreatedAt = asset, time.Unix(0, created).UTC()
+		legacy = append(legacy, stored{userID, &f})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	hashed, collisions := backfillHashes(legacy, func(userID, hash string) string { return holders[[2]string{userID, hash}] })
+	r.collisions = collisions
+	for _, l := range hashed {
+		if l.fav.ContentHash == "" {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE favourites SET content_hash = ? WHERE user_id = ? AND id = ?`, l.fav.ContentHash, l.userID, l.fav.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HashCollisions lists the favourites the v11 migration left without a content hash as
+// duplicates. It is empty unless this open applied that migration.
+func (r *SQLiteRepo) HashCollisions() []HashCollision { return r.collisions }
+
+// Ping reports whether the database is reachable and answering queries.
+func (r *SQLiteRepo) Ping(ctx context.Context) error {
+	var one int
+	return r.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+}
+
+// Close closes the underlying database handle.
+func (r *SQLiteRepo) Close() error { return r.db.Close() }
+
+const favouriteColumns = `id, type, description, asset, created_at, updated_at, version, search_text, asset_id, content_hash, tags`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFavourite(row rowScanner) (*models.Favourite, error) {
+	var (
+		f       models.Favourite
+		asset   []byte
+		created int64
+		updated sql.NullInt64
+		tags    string
+	)
+	if err := row.Scan(&f.ID, &f.Type, &f.Description, &asset, &created, &updated, &f.Version, &f.SearchText, &f.AssetID, &f.ContentHash, &tags); err != nil {
+		return nil, err
+	}
+	if len(asset) > 0 {
+		f.Asset = asset
+	}
+	if err := json.Unmarshal([]byte(tags), &f.Tags); err != nil {
+		return nil, fmt.Errorf("corrupt tags of favourite %s: %w", f.ID, err)
+	}
+	if len(f.Tags) == 0 {
+		f.Tags = nil
+	}
+	f.CreatedAt = time.Unix(0, created).UTC()
+	if updated.Valid {
+		t := time.Unix(0, updated.Int64).UTC()
+		f.UpdatedAt = &t
+	}
+	return &f, nil
+}
+
+// List returns one page of a user's favourites. Filters become WHERE clauses so the
+// (user_id, type, created_at) and (user_id, description) indexes can serve them. Cursor
+// pages use a keyset predicate on (sort key, id), so their cost does not grow with how
+// deep the client has paged.
+func (r *SQLiteRepo) List(ctx context.Context, userID string, q ListQuery) (*ListPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortCreatedDesc
+	}
+	where, args := sqliteFilters(userID, q)
+
+	page := &ListPage{Items: make([]*models.Favourite, 0)}
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM favourites WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	if c := q.After; c != nil {
+		switch q.Sort {
+		case SortCreatedAsc:
+			ts := c.CreatedAt.UnixNano()
+			where += ` AND (created_at > ? OR (created_at = ? AND id > ?))`
+			args = append(args, ts, ts, c.ID)
+		case SortDescription:
+			where += ` AND (description > ? OR (description = ? AND id > ?))`
+			args = append(args, c.Description, c.Description, c.ID)
+		default:
+			ts := c.CreatedAt.UnixNano()
+			where += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+			args = append(args, ts, ts, c.ID)
+		}
+	}
+	query := `SELECT ` + favouriteColumns + ` FROM favourites WHERE ` + where + ` ORDER BY ` + sqliteOrderBy[q.Sort]
+	if q.Limit > 0 {
+		// Fetch one extra row to learn whether another page follows.
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	} else {
+		query += ` LIMIT -1`
+	}
+	if q.After == nil && q.Offset > 0 {
+		query += ` OFFSET ?`
+		args = append(args, q.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scanFavourite(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		page.Next = CursorOf(page.Items[q.Limit-1], q.Sort)
+	}
+	return page, nil
+}
+
+var sqliteOrderBy = map[SortOrder]string{
+	SortCreatedDesc: `created_at DESC, id DESC`,
+	SortCreatedAsc:  `created_at ASC, id ASC`,
+	SortDescription: `description ASC, id ASC`,
+}
+
+// sqliteFilters renders the query filters as a WHERE clause with its arguments.
+func sqliteFilters(userID string, q ListQuery) (string, []any) {
+	where := `user_id = ?`
+	args := []any{userID}
+	if q.IDs != nil {
+		if len(q.IDs) == 0 {
+			where += ` AND 0`
+		} else {
+			where += ` AND id IN ` + inList(len(q.IDs))
+			for _, id := range q.IDs {
+				args = append(args, id)
+			}
+		}
+	}
+	if len(q.Types) > 0 {
+		where += ` AND type IN (?` + strings.Repeat(`, ?`, len(q.Types)-1) + `)`
+		for _, t := range q.Types {
+			args = append(args, string(t))
+		}
+	}
+	if len(q.Tags) > 0 {
+		if q.AnyTag {
+			where += ` AND EXISTS (SELECT 1 FROM json_each(favourites.tags) WHERE value IN ` + inList(len(q.Tags)) + `)`
+			for _, t := range q.Tags {
+				args = append(args, t)
+			}
+		} else {
+			for _, t := range q.Tags {
+				where += ` AND EXISTS (SELECT 1 FROM json_each(favourites.tags) WHERE value = ?)`
+				args = append(args, t)
+			}
+		}
+	}
+	if !q.CreatedAfter.IsZero() {
+		where += ` AND created_at > ?`
+		args = append(args, q.CreatedAfter.UnixNano())
+	}
+	if !q.CreatedBefore.IsZero() {
+		where += ` AND created_at < ?`
+		args = append(args, q.CreatedBefore.UnixNano())
+	}
+	if q.Search != "" {
+		// instr() instead of LIKE so that % and _ in the search term are literal
+		needle := strings.ToLower(q.Search)
+		where += ` AND (instr(lower(description), ?) > 0 OR instr(search_text, ?) > 0)`
+		args = append(args, needle, needle)
+	}
+	return where, args
+}
+
+func (r *SQLiteRepo) Create(ctx context.Context, userID string, fav *models.Favourite) error {
+	return sqliteCreate(ctx, r.db, userID, fav)
+}
+
+// sqlExecutor is satisfied by *sql.DB and *sql.Tx, so the write statements can run
+// on their own or inside a batch transaction.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func sqliteCreate(ctx context.Context, db sqlExecutor, userID string, fav *models.Favourite) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO favourites (user_id, `+favouriteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, fav.ID, fav.Type, fav.Description, append([]byte{}, fav.Asset...), fav.CreatedAt.UnixNano(), nullableTime(fav.UpdatedAt),
+		max(fav.Version, 1), fav.SearchText, fav.AssetID, fav.ContentHash, tagsJSON(fav.Tags))
+	return duplicateOf(ctx, db, userID, fav.ContentHash, err)
+}
+
+// duplicateOf turns a violation of the per-user content hash index into a *DuplicateError
+// naming the favourite that holds hash. Other errors are returned unchanged.
+func duplicateOf(ctx context.Context, db sqlExecutor, userID, hash string, err error) error {
+	var se sqlite3.Error
+	if hash == "" || !errors.As(err, &se) || se.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return err
+	}
+	var id string
+	if lerr := db.QueryRowContext(ctx, `SELECT id FROM favourites WHERE user_id = ? AND content_hash = ?`, userID, hash).Scan(&id); lerr != nil {
+		return err
+	}
+	return &DuplicateError{ExistingID: id}
+}
+
+// tagsJSON encodes tags for the tags column; nil becomes an empty array.
+func tagsJSON(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
+
+func nullableTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+func (r *SQLiteRepo) Get(ctx context.Context, userID, favID string) (*models.Favourite, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+favouriteColumns+` FROM favourites WHERE user_id = ? AND id = ?`, userID, favID)
+	f, err := scanFavourite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (r *SQLiteRepo) CountByType(ctx context.Context) (map[models.AssetType]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT type, COUNT(*) FROM favourites GROUP BY type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[models.AssetType]int)
+	for rows.Next() {
+		var t models.AssetType
+		var n int
+		if err := rows.Scan(&t, &n); err != nil {
+			return nil, err
+		}
+		counts[t] = n
+	}
+	return counts, rows.Err()
+}
+
+func (r *SQLiteRepo) TagCounts(ctx context.Context, userID string) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT t.value, COUNT(*) FROM favourites, json_each(favourites.tags) AS t
+		WHERE favourites.user_id = ? GROUP BY t.value`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var tag string
+		var n int
+		if err := rows.Scan(&tag, &n); err != nil {
+			return nil, err
+		}
+		counts[tag] = n
+	}
+	return counts, rows.Err()
+}
+
+func (r *SQLiteRepo) SetReferenceSearchText(ctx context.Context, assetID, searchText string) (int, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE favourites SET search_text = ? WHERE asset_id = ? AND search_text != ?`,
+		searchText, assetID, searchText)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Update modifies only the fields set in u; COALESCE keeps the stored value for nil ones.
+// The version predicate makes the statement a compare-and-swap when IfVersion is set.
+func (r *SQLiteRepo) Update(ctx context.Context, userID, favID string, u Update) (*models.Favourite, error) {
+	return sqliteUpdate(ctx, r.db, userID, favID, u)
+}
+
+func sqliteUpdate(ctx context.Context, db sqlExecutor, userID, favID string, u Update) (*models.Favourite, error) {
+	var asset, tags any
+	if u.Asset != nil {
+		asset = []byte(u.Asset)
+	}
+	if u.Tags != nil {
+		tags = tagsJSON(u.Tags)
+	}
+	row := db.QueryRowContext(ctx, `UPDATE favourites SET
+			description = COALESCE(?, description),
+			asset       = COALESCE(?, asset),
+			search_text = COALESCE(?, search_text),
+			content_hash = COALESCE(?, content_hash),
+			tags        = COALESCE(?, tags),
+			updated_at  = ?,
+			version     = version + 1
+		WHERE user_id = ? AND id = ? AND (? = 0 OR version = ?)
+		RETURNING `+favouriteColumns,
+		u.Description, asset, u.SearchText, u.ContentHash, tags, u.UpdatedAt.UnixNano(), userID, favID, u.IfVersion, u.IfVersion)
+	f, err := scanFavourite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, missReason(ctx, db, userID, favID)
+	}
+	if err != nil && u.ContentHash != nil {
+		return nil, duplicateOf(ctx, db, userID, *u.ContentHash, err)
+	}
+	return f, err
+}
+
+// missReason explains why a conditional statement matched no row: either the
+// favourite does not exist or its version moved on.
+func missReason(ctx context.Context, db sqlExecutor, userID, favID string) error {
+	var one int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM favourites WHERE user_id = ? AND id = ?`, userID, favID).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return err
+	default:
+		return ErrVersionMismatch
+	}
+}
+
+func (r *SQLiteRepo) Delete(ctx context.Context, userID, favID string, ifVersion int64) error {
+	return sqliteDelete(ctx, r.db, userID, favID, ifVersion)
+}
+
+func sqliteDelete(ctx context.Context, db sqlExecutor, userID, favID string, ifVersion int64) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM favourites WHERE user_id = ? AND id = ? AND (? = 0 OR version = ?)`,
+		userID, favID, ifVersion, ifVersion)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return missReason(ctx, db, userID, favID)
+	}
+	return nil
+}
+
+// Apply runs the batch in one transaction; the first failing statement rolls it back.
+func (r *SQLiteRepo) Apply(ctx context.Context, userID string, ops []Op) ([]*models.Favourite, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	out := make([]*models.Favourite, len(ops))
+	for i, op := range ops {
+		switch op.Kind {
+		case OpCreate:
+			if op.Fav == nil {
+				err = errors.New("create without favourite")
+			} else if err = sqliteCreate(ctx, tx, userID, op.Fav); err == nil {
+				out[i] = op.Fav
+			}
+		case OpUpdate:
+			out[i], err = sqliteUpdate(ctx, tx, userID, op.FavID, op.Update)
+		case OpDelete:
+			err = sqliteDelete(ctx, tx, userID, op.FavID, op.IfVersion)
+		default:
+			err = fmt.Errorf("unknown op %q", op.Kind)
+		}
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
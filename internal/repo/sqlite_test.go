@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestSQLite(t *testing.T) *SQLiteRepo {
+	t.Helper()
+	r, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "favourites.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// TestSQLiteRepo_CRUD exercises the full lifecycle and the ErrNotFound mapping.
+func TestSQLiteRepo_CRUD(t *testing.T) {
+	r := openTestSQLite(t)
+
+	older := newFav("a")
+	older.CreatedAt = time.Now().UTC().Add(-time.Minute)
+	if err := r.Create(ctx, "kostas", older); err != nil {
+		t.Fatalf("create a: %v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("b")); err != nil {
+		t.Fatalf("create b: %v", err)
+	}
+
+	page, err := r.List(ctx, "kostas", ListQuery{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	list := page.Items
+	if len(list) != 2 || list[0].ID != "b" {
+		t.Fatalf("expected newest first, got %+v", list)
+	}
+	if !list[1].CreatedAt.Equal(older.CreatedAt) {
+		t.Fatalf("created_at not round-tripped: %v vs %v", list[1].CreatedAt, older.CreatedAt)
+	}
+
+	upd, err := r.Update(ctx, "kostas", "a", Update{Description: strPtr("updated"), UpdatedAt: time.Now()})
+	if err != nil || upd.Description != "updated" {
+		t.Fatalf("update: %+v %v", upd, err)
+	}
+	if err := r.Delete(ctx, "kostas", "a", 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := r.Get(ctx, "kostas", "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get deleted: want ErrNotFound, got %v", err)
+	}
+	if _, err := r.Update(ctx, "kostas", "a", Update{Description: strPtr("x"), UpdatedAt: time.Now()}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("update missing: want ErrNotFound, got %v", err)
+	}
+	if err := r.Delete(ctx, "other", "b", 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete other user's favourite: want ErrNotFound, got %v", err)
+	}
+}
+
+// TestSQLiteRepo_MigrationsAreIdempotent reopens an existing database and checks its health.
+func TestSQLiteRepo_MigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favourites.db")
+	r, err := OpenSQLiteRepo(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := r.Create(ctx, "kostas", newFav("a")); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	r.Close()
+
+	r, err = OpenSQLiteRepo(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	var version int
+	if err := r.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || version != len(migrations) {
+		t.Fatalf("schema version=%d err=%v", version, err)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if _, err := r.Get(ctx, "kostas", "a"); err != nil {
+		t.Fatalf("data lost across reopen: %v", err)
+	}
+}
+
+// TestSQLiteRepo_RespectsDeadline checks that an expired context aborts the query.
+func TestSQLiteRepo_RespectsDeadline(t *testing.T) {
+	r := openTestSQLite(t)
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := r.List(expired, "kostas", ListQuery{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+	if err := r.Create(expired, "kostas", newFav("a")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestSQLiteRepo_BackfillsContentHashes reopens a database at schema v6, before
+// deduplication: the oldest of two favourites with the same content gets the hash, the
+// other stays exempt, and later duplicates of the first are rejected.
+func TestSQLiteRepo_BackfillsContentHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favourites.db")
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	stmts := append([]string{`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at INTEGER NOT NULL)`}, migrations[:6]...)
+	stmts = append(stmts,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES (1, 0), (2, 0), (3, 0), (4, 0), (5, 0), (6, 0)`,
+		`INSERT INTO favourites (user_id, id, type, asset, created_at, asset_id) VALUES
+			('kostas', 'b', 'insight', '{"text":"t","type":"insight","description":"again"}', 2, ''),
+			('kostas', 'a', 'insight', '{"type":"insight","text":"t"}', 1, ''),
+			('kostas', 'r', 'chart', '', 3, 'x'),
+			('maria', 'm', 'insight', '{"type":"insight","text":"t"}', 4, '')`)
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("build v6 database: %v", err)
+		}
+	}
+	db.Close()
+
+	r, err := OpenSQLiteRepo(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	hash := ContentHash(json.RawMessage(`{"type":"insight","text":"t"}`))
+	want := map[[2]string]string{{"kostas", "a"}: hash, {"kostas", "b"}: "", {"kostas", "r"}: ReferenceHash("x"), {"maria", "m"}: hash}
+	for key, h := range want {
+		if f, err := r.Get(ctx, key[0], key[1]); err != nil || f.ContentHash != h {
+			t.Fatalf("%v: hash = %+v, %v; want %q", key, f, err, h)
+		}
+	}
+	if got := r.HashCollisions(); len(got) != 1 || got[0] != (HashCollision{UserID: "kostas", FavID: "b", ExistingID: "a"}) {
+		t.Fatalf("collisions = %+v", got)
+	}
+	dup := newFav("c")
+	dup.ContentHash = hash
+	var de *DuplicateError
+	if err := r.Create(ctx, "kostas", dup); !errors.As(err, &de) || de.ExistingID != "a" {
+		t.Fatalf("want duplicate of a, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+const tracerName = "github.com/KostasDasios/platform-go-challenge/internal/repo"
+
+// tracedRepo wraps a Repository and records a client span for every call.
+type tracedRepo struct {
+	next    Repository
+	backend string
+	tracer  trace.Tracer
+}
+
+// Traced returns r with every call recorded as an OpenTelemetry span named
+// "repo.<Method>" and tagged with the backend name. Expected outcomes (not found,
+// version mismatch) are recorded as events; other errors mark the span as failed.
+func Traced(r Repository, backend string) Repository {
+	return &tracedRepo{next: r, backend: backend, tracer: otel.Tracer(tracerName)}
+}
+
+func (t *tracedRepo) start(ctx context.Context, op, userID string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("repo.backend", t.backend)}
+	if userID != "" {
+		attrs = append(attrs, attribute.String("user.id", userID))
+	}
+	return t.tracer.Start(ctx, "repo."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrVersionMismatch):
+		span.AddEvent(err.Error())
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedRepo) List(ctx context.Context, userID string, q ListQuery) (*ListPage, error) {
+	ctx, span := t.start(ctx, "List", userID)
+	page, err := t.next.List(ctx, userID, q)
+	if err == nil {
+		span.SetAttributes(attribute.Int("repo.items", len(page.Items)))
+	}
+	endSpan(span, err)
+	return page, err
+}
+
+func (t *tracedRepo) Create(ctx context.Context, userID string, fav *models.Favourite) error {
+	ctx, span := t.start(ctx, "Create", userID)
+	err := t.next.Create(ctx, userID, fav)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedRepo) Get(ctx context.Context, userID, favID string) (*models.Favourite, error) {
+	ctx, span := t.start(ctx, "Get", userID)
+	f, err := t.next.Get(ctx, userID, favID)
+	endSpan(span, err)
+	return f, err
+}
+
+func (t *tracedRepo) Update(ctx context.Context, userID, favID string, u Update) (*models.Favourite, error) {
+	ctx, span := t.start(ctx, "Update", userID)
+	f, err := t.next.Update(ctx, userID, favID, u)
+	endSpan(span, err)
+	return f, err
+}
+
+func (t *tracedRepo) Delete(ctx context.Context, userID, favID string, ifVersion int64) error {
+	ctx, span := t.start(ctx, "Delete", userID)
+	err := t.next.Delete(ctx, userID, favID, ifVersion)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedRepo) Apply(ctx context.Context, userID string, ops []Op) ([]*models.Favourite, error) {
+	ctx, span := t.start(ctx, "Apply", userID)
+	span.SetAttributes(attribute.Int("repo.ops", len(ops)))
+	out, err := t.next.Apply(ctx, userID, ops)
+	endSpan(span, err)
+	return out, err
+}
+
+func (t *tracedRepo) CountByType(ctx context.Context) (map[models.AssetType]int, error) {
+	ctx, span := t.start(ctx, "CountByType", "")
+	counts, err := t.next.CountByType(ctx)
+	endSpan(span, err)
+	return counts, err
+}
+
+func (t *tracedRepo) TagCounts(ctx context.Context, userID string) (map[string]int, error) {
+	ctx, span := t.start(ctx, "TagCounts", userID)
+	counts, err := t.next.TagCounts(ctx, userID)
+	endSpan(span, err)
+	return counts, err
+}
+
+func (t *tracedRepo) SetReferenceSearchText(ctx context.Context, assetID, searchText string) (int, error) {
+	ctx, span := t.start(ctx, "SetReferenceSearchText", "")
+	n, err := t.next.SetReferenceSearchText(ctx, assetID, searchText)
+	if err == nil {
+		span.SetAttributes(attribute.Int("repo.items", n))
+	}
+	endSpan(span, err)
+	return n, err
+}
+
+// tracedAssets is tracedRepo for the asset catalog.
+type tracedAssets struct {
+	next  AssetRepository
+	spans tracedRepo // provides start; its next is unused
+}
+
+// TracedAssets returns r with every call recorded as a "repo.<Method>" span, like Traced.
+func TracedAssets(r AssetRepository, backend string) AssetRepository {
+	return &tracedAssets{next: r, spans: tracedRepo{backend: backend, tracer: otel.Tracer(tracerName)}}
+}
+
+func (t *tracedAssets) ListAssets(ctx context.Context, q AssetQuery) (*AssetPage, error) {
+	ctx, span := t.spans.start(ctx, "ListAssets", "")
+	page, err := t.next.ListAssets(ctx, q)
+	if err == nil {
+		span.SetAttributes(attribute.Int("repo.items", len(page.Items)))
+	}
+	endSpan(span, err)
+	return page, err
+}
+
+func (t *tracedAssets) CreateAsset(ctx context.Context, a *models.Asset) error {
+	ctx, span := t.spans.start(ctx, "CreateAsset", "")
+	err := t.next.CreateAsset(ctx, a)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedAssets) GetAsset(ctx context.Context, id string) (*models.Asset, error) {
+	ctx, span := t.spans.start(ctx, "GetAsset", "")
+	a, err := t.next.GetAsset(ctx, id)
+	endSpan(span, err)
+	return a, err
+}
+
+func (t *tracedAssets) GetAssets(ctx context.Context, ids []string) (map[string]*models.Asset, error) {
+	ctx, span := t.spans.start(ctx, "GetAssets", "")
+	span.SetAttributes(attribute.Int("repo.ids", len(ids)))
+	found, err := t.next.GetAssets(ctx, ids)
+	endSpan(span, err)
+	return found, err
+}
+
+func (t *tracedAssets) UpdateAsset(ctx context.Context, id string, u AssetUpdate) (*models.Asset, error) {
+	ctx, span := t.spans.start(ctx, "UpdateAsset", "")
+	a, err := t.next.UpdateAsset(ctx, id, u)
+	endSpan(span, err)
+	return a, err
+}
+
+func (t *tracedAssets) DeleteAsset(ctx context.Context, id string, ifVersion int64) error {
+	ctx, span := t.spans.start(ctx, "DeleteAsset", "")
+	err := t.next.DeleteAsset(ctx, id, ifVersion)
+	endSpan(span, err)
+	return err
+}
+
+// tracedCollections is tracedRepo for collections.
+type tracedCollections struct {
+	next  CollectionRepository
+	spans tracedRepo // provides start; its next is unused
+}
+
+// TracedCollections returns r with every call recorded as a "repo.<Method>" span, like Traced.
+func TracedCollections(r CollectionRepository, backend string) CollectionRepository {
+	return &tracedCollections{next: r, spans: tracedRepo{backend: backend, tracer: otel.Tracer(tracerName)}}
+}
+
+func (t *tracedCollections) ListCollections(ctx context.Context, userID string) ([]*models.Collection, error) {
+	ctx, span := t.spans.start(ctx, "ListCollections", userID)
+	cs, err := t.next.ListCollections(ctx, userID)
+	if err == nil {
+		span.SetAttributes(attribute.Int("repo.items", len(cs)))
+	}
+	endSpan(span, err)
+	return cs, err
+}
+
+func (t *tracedCollections) CreateCollection(ctx context.Context, userID string, c *models.Collection) error {
+	ctx, span := t.spans.start(ctx, "CreateCollection", userID)
+	err := t.next.CreateCollection(ctx, userID, c)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedCollections) GetCollection(ctx context.Context, userID, id string) (*models.Collection, error) {
+	ctx, span := t.spans.start(ctx, "GetCollection", userID)
+	c, err := t.next.GetCollection(ctx, userID, id)
+	endSpan(span, err)
+	return c, err
+}
+
+func (t *tracedCollections) UpdateCollection(ctx context.Context, userID, id string, u CollectionUpdate) (*models.Collection, error) {
+	ctx, span := t.spans.start(ctx, "UpdateCollection", userID)
+	c, err := t.next.UpdateCollection(ctx, userID, id, u)
+	endSpan(span, err)
+	return c, err
+}
+
+func (t *tracedCollections) DeleteCollection(ctx context.Context, userID, id string, ifVersion int64) error {
+	ctx, span := t.spans.start(ctx, "DeleteCollection", userID)
+	err := t.next.DeleteCollection(ctx, userID, id, ifVersion)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedCollections) ForgetFavourites(ctx context.Context, userID string, favIDs []string, at time.Time) error {
+	ctx, span := t.spans.start(ctx, "ForgetFavourites", userID)
+	span.SetAttributes(attribute.Int("repo.ids", len(favIDs)))
+	err := t.next.ForgetFavourites(ctx, userID, favIDs, at)
+	endSpan(span, err)
+	return err
+}
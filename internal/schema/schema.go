@@ -0,0 +1,259 @@
+// Package schema validates JSON documents against the component schemas of an
+// OpenAPI 3.1 description, so request validation cannot drift from the published spec.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+)
+
+// specURL names the OpenAPI document inside the compiler; refs such as
+// "#/components/schemas/Chart" resolve against it.
+const specURL = "urn:openapi"
+
+// Set holds the compiled component schemas of one OpenAPI description.
+type Set struct {
+	schemas        map[string]*Schema
+	discriminators map[string]Discriminator
+}
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	sch *jsonschema.Schema
+}
+
+// Discriminator is the discriminator of a oneOf component schema: the property that
+// selects the variant and the component schema name for each of its values.
+type Discriminator struct {
+	Property string
+	Mapping  map[string]string
+}
+
+// Violation is one way a document fails its schema. Field is the dotted path to the
+// offending value ("" for the document itself), e.g. "age_groups.0".
+type Violation struct {
+	Field  string
+	Reason string
+}
+
+// parse decodes a YAML or JSON document into the form the compiler expects, and
+// also returns it as JSON.
+func parse(src []byte) (any, []byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, nil, err
+	}
+	// Round-trip through JSON so that numbers and maps have the types the compiler expects.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc, err = jsonschema.UnmarshalJSON(bytes.NewReader(b)); err != nil {
+		return nil, nil, err
+	}
+	return doc, b, nil
+}
+
+// Compile compiles a standalone JSON Schema (YAML or JSON); the 2020-12 dialect
+// applies unless the document declares another one with $schema.
+func Compile(src []byte) (*Schema, error) {
+	doc, _, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	const url = "urn:schema"
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	if err := c.AddResource(url, doc); err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+	sch, err := c.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+	return &Schema{sch}, nil
+}
+
+// MustCompile is like Compile but panics on error.
+func MustCompile(src []byte) *Schema {
+	s, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Load parses an OpenAPI 3.1 description (YAML or JSON) and compiles every schema
+// under components/schemas with the JSON Schema 2020-12 dialect OpenAPI 3.1 uses.
+func Load(spec []byte) (*Set, error) {
+	doc, b, err := parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("parse openapi: %w", err)
+	}
+	var components struct {
+		Components struct {
+			Schemas map[string]struct {
+				Discriminator *struct {
+					PropertyName string            `json:"propertyName"`
+					Mapping      map[string]string `json:"mapping"`
+				} `json:"discriminator"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &components); err != nil {
+		return nil, fmt.Errorf("parse openapi: %w", err)
+	}
+
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	if err := c.AddResource(specURL, doc); err != nil {
+		return nil, fmt.Errorf("load openapi: %w", err)
+	}
+	s := &Set{schemas: map[string]*Schema{}, discriminators: map[string]Discriminator{}}
+	for name, def := range components.Components.Schemas {
+		sch, err := c.Compile(specURL + "#/components/schemas/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("compile schema %s: %w", name, err)
+		}
+		s.schemas[name] = &Schema{sch}
+		if d := def.Discriminator; d != nil {
+			m := Discriminator{Property: d.PropertyName, Mapping: map[string]string{}}
+			for value, ref := range d.Mapping {
+				m.Mapping[value] = strings.TrimPrefix(ref, "#/components/schemas/")
+			}
+			s.discriminators[name] = m
+		}
+	}
+	return s, nil
+}
+
+// MustLoad is like Load but panics on error; use it for a spec embedded at build time.
+func MustLoad(spec []byte) *Set {
+	s, err := Load(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Schema returns the named component schema, or nil if there is none.
+func (s *Set) Schema(name string) *Schema { return s.schemas[name] }
+
+// Discriminator returns the discriminator of the named component schema, if it has one.
+func (s *Set) Discriminator(name string) (Discriminator, bool) {
+	d, ok := s.discriminators[name]
+	return d, ok
+}
+
+// Validate checks raw against the named component schema; see Schema.Validate.
+func (s *Set) Validate(name string, raw []byte) ([]Violation, error) {
+	sch, ok := s.schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", name)
+	}
+	return sch.Validate(raw)
+}
+
+// Validate checks raw against the schema and returns every violation found, ordered
+// by field. A document that is not JSON is reported as a single violation of the
+// document itself.
+func (s *Schema) Validate(raw []byte) ([]Violation, error) {
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return []Violation{{Reason: "must be valid JSON"}}, nil
+	}
+	err = s.sch.Validate(v)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, err
+	}
+	var out []Violation
+	collect(ve, &out)
+	slices.SortStableFunc(out, func(a, b Violation) int { return strings.Compare(a.Field, b.Field) })
+	return out, nil
+}
+
+var printer = message.NewPrinter(language.English)
+
+// collect appends a violation for every leaf of the error tree; inner nodes only
+// group the errors of their subschemas.
+func collect(ve *jsonschema.ValidationError, out *[]Violation) {
+	if len(ve.Causes) > 0 {
+		for _, c := range ve.Causes {
+			collect(c, out)
+		}
+		return
+	}
+	field := strings.Join(ve.InstanceLocation, ".")
+	if k, ok := ve.ErrorKind.(*kind.Required); ok {
+		for _, m := range k.Missing {
+			*out = append(*out, Violation{Field: join(field, m), Reason: "is required"})
+		}
+		return
+	}
+	*out = append(*out, Violation{Field: field, Reason: reason(ve.ErrorKind)})
+}
+
+func join(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+// reason phrases the common error kinds for API clients, e.g. "must be a string"
+// rather than "got number, want string".
+func reason(k jsonschema.ErrorKind) string {
+	switch k := k.(type) {
+	case *kind.Type:
+		want := make([]string, len(k.Want))
+		for i, t := range k.Want {
+			want[i] = strings.TrimSpace(article(t) + " " + t)
+		}
+		return "must be " + strings.Join(want, " or ")
+	case *kind.Enum:
+		want := make([]string, len(k.Want))
+		for i, v := range k.Want {
+			want[i] = fmt.Sprint(v)
+		}
+		return "must be one of " + strings.Join(want, ", ")
+	case *kind.Const:
+		return fmt.Sprintf("must be %v", k.Want)
+	case *kind.MinItems:
+		if k.Want == 1 {
+			return "must not be empty"
+		}
+		return fmt.Sprintf("must have at least %d items", k.Want)
+	case *kind.MinLength:
+		if k.Want == 1 {
+			return "must not be empty"
+		}
+		return fmt.Sprintf("must be at least %d characters", k.Want)
+	case *kind.Pattern:
+		if k.Want == `\S` {
+			return "must not be blank"
+		}
+		return "must match " + k.Want
+	}
+	return k.LocalizedString(printer)
+}
+
+func article(typ string) string {
+	switch typ {
+	case "array", "object", "integer":
+		return "an"
+	case "null":
+		return ""
+	}
+	return "a"
+}
@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/KostasDasios/platform-go-challenge/api"
+)
+
+// TestLoad_EmbeddedSpec checks that the published spec compiles and that its Asset
+// discriminator maps every asset type to a compiled schema.
+func TestLoad_EmbeddedSpec(t *testing.T) {
+	s, err := Load(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	d, ok := s.Discriminator("Asset")
+	if !ok || d.Property != "type" {
+		t.Fatalf("Asset discriminator = %+v, %v", d, ok)
+	}
+	for _, typ := range []string{"chart", "insight", "audience"} {
+		name, ok := d.Mapping[typ]
+		if _, compiled := s.schemas[name]; !ok || !compiled {
+			t.Errorf("type %q maps to %q (compiled: %v)", typ, name, compiled)
+		}
+	}
+	if _, err := s.Validate("Nope", []byte(`{}`)); err == nil {
+		t.Fatalf("expected error for unknown schema")
+	}
+}
+
+// TestValidate_ReportsAllViolations checks that every violation is reported, ordered
+// by field, with client-facing reasons.
+func TestValidate_ReportsAllViolations(t *testing.T) {
+	s := MustLoad(api.OpenAPI)
+	cases := []struct {
+		name, schema, doc string
+		want              []Violation
+	}{
+		{"valid", "Audience", `{"type":"audience","gender":"male","age_groups":["18-24"]}`, nil},
+		{"audience", "Audience", `{"type":"audience","gender":"other","age_groups":[1],"hours_social_daily":"2"}`, []Violation{
+			{"age_groups.0", "must be a string"},
+			{"gender", "must be one of male, female"},
+			{"hours_social_daily", "must be a number"},
+		}},
+		{"missing", "Audience", `{"type":"audience"}`, []Violation{{"age_groups", "is required"}, {"gender", "is required"}}},
+		{"chart", "Chart", `{"type":"chart","title":"  ","data":[]}`, []Violation{{"data", "must not be empty"}, {"title", "must not be blank"}}},
+		{"insight", "Insight", `{"type":"chart","text":"t","description":3}`, []Violation{{"description", "must be a string"}, {"type", "must be insight"}}},
+		{"not json", "Insight", `{`, []Violation{{"", "must be valid JSON"}}},
+	}
+	for _, c := range cases {
+		got, err := s.Validate(c.schema, []byte(c.doc))
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v (%v), want %+v", c.name, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/service"
+)
+
+// batchItemResult is the per-operation entry of a batch response.
+type batchItemResult struct {
+	Index     int                       `json:"index"`
+	Status    int                       `json:"status"`
+	Favourite *models.Favourite         `json:"favourite,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+	Code      string                    `json:"code,omitempty"`
+	Errors    []middleware.ProblemField `json:"errors,omitempty"`
+	// ExistingID is set when a create duplicates one of the user's favourites.
+	ExistingID string `json:"existing_id,omitempty"`
+}
+
+// handleBatch applies a list of create/patch/delete operations in one request, so bulk
+// imports count once against the rate limit. With ?atomic=true the whole batch is
+// applied or none of it; the response status is then that of the failing operation.
+// ?allow_duplicates=true exempts the creates from the duplicate check, for legacy imports.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request, userID string) {
+	atomic, err := queryBool(r, "atomic")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	allowDuplicates, err := queryBool(r, "allow_duplicates")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	var payload struct {
+		Operations []struct {
+			Op          string          `json:"op"`
+			ID          string          `json:"id"`
+			Asset       json.RawMessage `json:"asset"`
+			AssetID     string          `json:"asset_id"`
+			Description *string         `json:"description"`
+			Tags        []string        `json:"tags"`
+			IfVersion   int64           `json:"if_version"`
+		} `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid json body")
+		return
+	}
+	ops := make([]service.BatchOp, len(payload.Operations))
+	for i, op := range payload.Operations {
+		ops[i] = service.BatchOp{Op: op.Op, ID: op.ID, Asset: op.Asset, AssetID: op.AssetID, Description: op.Description, Tags: op.Tags,
+			IfVersion: op.IfVersion, AllowDuplicates: allowDuplicates}
+	}
+
+	results, err := s.svc.ApplyBatch(r.Context(), userID, ops, atomic)
+	if err != nil && !errors.Is(err, service.ErrBatchAborted) {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	out := make([]batchItemResult, len(results))
+	for i, res := range results {
+		out[i] = batchItemResult{Index: i, Status: batchItemStatus(ops[i].Op, res.Err), Favourite: res.Favourite}
+		if res.Err != nil {
+			p := problemFor(res.Err)
+			out[i].Error, out[i].Code, out[i].Errors, out[i].ExistingID = p.Detail, p.Code, p.Errors, p.ExistingID
+			if p.Status == http.StatusInternalServerError {
+				s.log.ErrorContext(r.Context(), "batch operation failed", "index", i, "err", res.Err)
+			}
+			if atomic && !errors.Is(res.Err, service.ErrBatchAborted) {
+				status = out[i].Status
+			}
+		}
+	}
+	body := map[string]any{"atomic": atomic, "results": out}
+	if status >= http.StatusBadRequest {
+		body["request_id"] = middleware.RequestIDFromContext(r.Context())
+	}
+	writeJSON(w, status, body)
+}
+
+// batchItemStatus maps the outcome of one batch operation to the status the
+// equivalent single request would have returned; aborted operations get 424.
+func batchItemStatus(op string, err error) int {
+	switch {
+	case err == nil && op == service.BatchCreate:
+		return http.StatusCreated
+	case err == nil && op == service.BatchDelete:
+		return http.StatusNoContent
+	case err == nil:
+		return http.StatusOK
+	}
+	return problemFor(err).Status
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/config"
+	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// openCatalog constructs the asset catalog for the configured backend. Backends that
+// store the catalog themselves (SQLite) serve it from the same database; the file
+// backend keeps it in the data directory and the memory backend in memory.
+func openCatalog(cfg *config.Config, r repo.Repository) (repo.AssetRepository, error) {
+	if c, ok := r.(repo.AssetRepository); ok {
+		return c, nil
+	}
+	if cfg.StorageBackend == "file" {
+		return repo.OpenFileAssetRepo(cfg.DataDir)
+	}
+	return repo.NewInMemoryAssetRepo(), nil
+}
+
+// assetETag renders a catalog asset's version as a strong entity tag.
+func assetETag(a *models.Asset) string {
+	return `"` + strconv.FormatInt(a.Version, 10) + `"`
+}
+
+// routeAssets serves the shared asset catalog:
+//
+//	GET    /assets
+//	POST   /assets
+//	GET    /assets/{assetID}
+//	PUT    /assets/{assetID}
+//	DELETE /assets/{assetID}
+func (s *Server) routeAssets(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) > 2 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleListAssets(w, r)
+		case http.MethodPost:
+			s.handleCreateAsset(w, r)
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+		}
+		return
+	}
+	switch id := parts[1]; r.Method {
+	case http.MethodGet:
+		s.handleGetAsset(w, r, id)
+	case http.MethodPut:
+		s.handlePutAsset(w, r, id)
+	case http.MethodDelete:
+		s.handleDeleteAsset(w, r, id)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+	}
+}
+
+// handleListAssets returns one page of the catalog, optionally filtered by type.
+func (s *Server) handleListAssets(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	// the catalog only filters by type; a favourites filter would otherwise be ignored silently
+	for name := range qs {
+		if name != "type" && name != "limit" && name != "offset" {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unsupported parameter %q: /assets accepts type, limit and offset", name))
+			return
+		}
+	}
+	limit := defaultLimit
+	if n, err := strconv.Atoi(qs.Get("limit")); err == nil && n > 0 {
+		limit = min(n, maxLimit)
+	}
+	offset := 0
+	if n, err := strconv.Atoi(qs.Get("offset")); err == nil && n >= 0 {
+		offset = n
+	}
+	types, err := parseTypeFilter(qs, s.svc.AssetTypes())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	page, err := s.svc.ListAssets(r.Context(), repo.AssetQuery{Limit: limit, Offset: offset, Types: types})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"assets": page.Items,
+		"total":  page.Total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// decodeAsset reads a {"asset": {...}} request body.
+func decodeAsset(w http.ResponseWriter, r *http.Request) (json.RawMessage, bool) {
+	var payload struct {
+		Asset json.RawMessage `json:"asset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Asset == nil {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "asset is required",
+			Errors: []middleware.ProblemField{{Field: "asset", Reason: "is required"}}})
+		return nil, false
+	}
+	return payload.Asset, true
+}
+
+func (s *Server) handleCreateAsset(w http.ResponseWriter, r *http.Request) {
+	raw, ok := decodeAsset(w, r)
+	if !ok {
+		return
+	}
+	a, err := s.svc.CreateAsset(r.Context(), raw)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", assetETag(a))
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *Server) handleGetAsset(w http.ResponseWriter, r *http.Request, id string) {
+	a, err := s.svc.GetAsset(r.Context(), id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", assetETag(a))
+	writeJSON(w, http.StatusOK, a)
+}
+
+// assetIfMatch is ifMatchVersion for catalog assets.
+func (s *Server) assetIfMatch(r *http.Request, id string) (int64, error) {
+	return ifMatch(r, func() (int64, error) {
+		cur, err := s.svc.GetAsset(r.Context(), id)
+		if err != nil {
+			return 0, err
+		}
+		return cur.Version, nil
+	})
+}
+
+// handlePutAsset replaces an asset's payload; every favourite referencing it follows.
+func (s *Server) handlePutAsset(w http.ResponseWriter, r *http.Request, id string) {
+	raw, ok := decodeAsset(w, r)
+	if !ok {
+		return
+	}
+	ifVersion, err := s.assetIfMatch(r, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	a, err := s.svc.ReplaceAsset(r.Context(), id, raw, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", assetETag(a))
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleDeleteAsset(w http.ResponseWriter, r *http.Request, id string) {
+	ifVersion, err := s.assetIfMatch(r, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.svc.DeleteAsset(r.Context(), id, ifVersion); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/config"
+	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// openCollections constructs the collection store for the configured backend, next to
+// the favourites like the asset catalog (see openCatalog).
+func openCollections(cfg *config.Config, r repo.Repository) (repo.CollectionRepository, error) {
+	if c, ok := r.(repo.CollectionRepository); ok {
+		return c, nil
+	}
+	if cfg.StorageBackend == "file" {
+		return repo.OpenFileCollectionRepo(cfg.DataDir)
+	}
+	return repo.NewInMemoryCollectionRepo(), nil
+}
+
+// collectionETag renders a collection's version as a strong entity tag.
+func collectionETag(c *models.Collection) string {
+	return `"` + strconv.FormatInt(c.Version, 10) + `"`
+}
+
+// routeCollections serves a user's collections; parts is the path after
+// /users/{userID}/collections:
+//
+//	GET    /users/{userID}/collections
+//	POST   /users/{userID}/collections
+//	GET    /users/{userID}/collections/{collectionID}
+//	PATCH  /users/{userID}/collections/{collectionID}
+//	DELETE /users/{userID}/collections/{collectionID}[?cascade=true]
+//	PUT    /users/{userID}/collections/{collectionID}/favourites
+//	POST   /users/{userID}/collections/{collectionID}/favourites
+//	DELETE /users/{userID}/collections/{collectionID}/favourites/{favID}
+func (s *Server) routeCollections(w http.ResponseWriter, r *http.Request, userID string, parts []string) {
+	notAllowed := func() {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+	}
+	switch {
+	case len(parts) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			s.handleListCollections(w, r, userID)
+		case http.MethodPost:
+			s.handleCreateCollection(w, r, userID)
+		default:
+			notAllowed()
+		}
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetCollection(w, r, userID, parts[0])
+		case http.MethodPatch:
+			s.handleRenameCollection(w, r, userID, parts[0])
+		case http.MethodDelete:
+			s.handleDeleteCollection(w, r, userID, parts[0])
+		default:
+			notAllowed()
+		}
+	case len(parts) == 2 && parts[1] == "favourites":
+		switch r.Method {
+		case http.MethodPut:
+			s.handleSetCollectionFavourites(w, r, userID, parts[0])
+		case http.MethodPost:
+			s.handleAddToCollection(w, r, userID, parts[0])
+		default:
+			notAllowed()
+		}
+	case len(parts) == 3 && parts[1] == "favourites":
+		if r.Method != http.MethodDelete {
+			notAllowed()
+			return
+		}
+		s.handleRemoveFromCollection(w, r, userID, parts[0], parts[2])
+	default:
+		writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
+	}
+}
+
+// writeCollection writes c with its ETag.
+func writeCollection(w http.ResponseWriter, status int, c *models.Collection) {
+	w.Header().Set("ETag", collectionETag(c))
+	writeJSON(w, status, c)
+}
+
+// collectionIfMatch is ifMatchVersion for collections.
+func (s *Server) collectionIfMatch(r *http.Request, userID, id string) (int64, error) {
+	return ifMatch(r, func() (int64, error) {
+		cur, err := s.svc.GetCollection(r.Context(), userID, id)
+		if err != nil {
+			return 0, err
+		}
+		return cur.Version, nil
+	})
+}
+
+func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request, userID string) {
+	cs, err := s.svc.ListCollections(r.Context(), userID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"collections": cs})
+}
+
+func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request, userID string) {
+	var payload struct {
+		Name         string   `json:"name"`
+		FavouriteIDs []string `json:"favourite_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid json body")
+		return
+	}
+	c, err := s.svc.CreateCollection(r.Context(), userID, payload.Name, payload.FavouriteIDs)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeCollection(w, http.StatusCreated, c)
+}
+
+func (s *Server) handleGetCollection(w http.ResponseWriter, r *http.Request, userID, id string) {
+	c, err := s.svc.GetCollection(r.Context(), userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeCollection(w, http.StatusOK, c)
+}
+
+func (s *Server) handleRenameCollection(w http.ResponseWriter, r *http.Request, userID, id string) {
+	var payload struct {
+		Name *string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == nil {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "name is required",
+			Errors: []middleware.ProblemField{{Field: "name", Reason: "is required"}}})
+		return
+	}
+	ifVersion, err := s.collectionIfMatch(r, userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	c, err := s.svc.RenameCollection(r.Context(), userID, id, *payload.Name, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeCollection(w, http.StatusOK, c)
+}
+
+// handleDeleteCollection deletes a collection; with ?cascade=true its favourites go too.
+func (s *Server) handleDeleteCollection(w http.ResponseWriter, r *http.Request, userID, id string) {
+	cascade, err := queryBool(r, "cascade")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	ifVersion, err := s.collectionIfMatch(r, userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.svc.DeleteCollection(r.Context(), userID, id, ifVersion, cascade); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetCollectionFavourites replaces the collection's members with the given
+// favourite IDs, in order; clients reorder a collection this way.
+func (s *Server) handleSetCollectionFavourites(w http.ResponseWriter, r *http.Request, userID, id string) {
+	var payload struct {
+		FavouriteIDs []string `json:"favourite_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.FavouriteIDs == nil {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "favourite_ids is required",
+			Errors: []middleware.ProblemField{{Field: "favourite_ids", Reason: "is required"}}})
+		return
+	}
+	ifVersion, err := s.collectionIfMatch(r, userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	c, err := s.svc.SetCollectionFavourites(r.Context(), userID, id, payload.FavouriteIDs, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeCollection(w, http.StatusOK, c)
+}
+
+// handleAddToCollection adds one favourite at an optional 0-based position (default:
+// the end); a favourite already in the collection is moved there.
+func (s *Server) handleAddToCollection(w http.ResponseWriter, r *http.Request, userID, id string) {
+	var payload struct {
+		FavouriteID string `json:"favourite_id"`
+		Position    *int   `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid json body")
+		return
+	}
+	ifVersion, err := s.collectionIfMatch(r, userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	c, err := s.svc.AddToCollection(r.Context(), userID, id, payload.FavouriteID, payload.Position, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeCollection(w, http.StatusOK, c)
+}
+
+func (s *Server) handleRemoveFromCollection(w http.ResponseWriter, r *http.Request, userID, id, favID string) {
+	ifVersion, err := s.collectionIfMatch(r, userID, id)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	c, err := s.svc.RemoveFromCollection(r.Context(), userID, id, favID, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", collectionETag(c))
+	w.WriteHeader(http.StatusNoContent)
+}
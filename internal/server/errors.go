@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+	"github.com/KostasDasios/platform-go-challenge/internal/service"
+)
+
+// Stable error codes for failures detected by the server itself; the service
+// (service.Code*) and the middleware (middleware.Code*) define the others.
+const (
+	codeInvalidRequest    = "invalid_request"
+	codeNotFound          = "not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeIdempotencyReused = "idempotency_key_reused"
+	codeIdempotencyBusy   = "idempotency_key_in_use"
+	codeBatchAborted      = "batch_aborted"
+	codeUnavailable       = "unavailable"
+	codeInternal          = "internal_error"
+)
+
+// errIfMatchFailed is returned by ifMatchVersion when no If-Match tag can match the favourite.
+var errIfMatchFailed = &service.Error{
+	Kind:    service.ErrPreconditionFailed,
+	Code:    service.CodeVersionMismatch,
+	Message: "If-Match does not match the current version",
+	Err:     repo.ErrVersionMismatch,
+}
+
+// kindStatus is the response status for each kind of service error.
+var kindStatus = []struct {
+	kind   error
+	status int
+}{
+	{service.ErrValidation, http.StatusBadRequest},
+	{service.ErrForbidden, http.StatusForbidden},
+	{service.ErrNotFound, http.StatusNotFound},
+	{service.ErrConflict, http.StatusConflict},
+	{service.ErrPreconditionFailed, http.StatusPreconditionFailed},
+}
+
+// problemFor maps an error returned by the service to a problem response. Storage work
+// abandoned because the request was cancelled or timed out yields 503, so those
+// failures are not reported as client errors; anything unclassified is a 500.
+func problemFor(err error) middleware.Problem {
+	var se *service.Error
+	switch {
+	case errors.As(err, &se):
+		p := middleware.Problem{Status: http.StatusInternalServerError, Code: se.Code, Detail: se.Message, ExistingID: se.ExistingID}
+		for _, k := range kindStatus {
+			if errors.Is(se, k.kind) {
+				p.Status = k.status
+				break
+			}
+		}
+		for _, f := range se.Fields {
+			p.Errors = append(p.Errors, middleware.ProblemField{Field: f.Field, Reason: f.Reason})
+		}
+		return p
+	case errors.Is(err, service.ErrBatchAborted):
+		return middleware.Problem{Status: http.StatusFailedDependency, Code: codeBatchAborted, Detail: err.Error()}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return middleware.Problem{Status: http.StatusServiceUnavailable, Code: codeUnavailable, Detail: "request cancelled or timed out"}
+	}
+	return middleware.Problem{Status: http.StatusInternalServerError, Code: codeInternal, Detail: "internal error"}
+}
+
+// writeServiceError writes the problem for err. Internal errors are logged, since
+// their cause is not disclosed to the client.
+func (s *Server) writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Status == http.StatusInternalServerError {
+		s.log.ErrorContext(r.Context(), "request failed", "err", err)
+	}
+	middleware.WriteProblem(w, r, p)
+}
+
+// writeError writes a problem with the given status, code and detail.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	middleware.WriteError(w, r, status, code, detail)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/service"
+)
+
+// etag renders a favourite's version as a strong entity tag, e.g. "3". A favourite
+// referencing a catalog asset also carries the asset's version, e.g. "3-2", so cached
+// copies are revalidated when the shared asset changes.
+func etag(f *models.Favourite) string {
+	v := strconv.FormatInt(f.Version, 10)
+	if f.AssetID != "" {
+		v += "-" + strconv.FormatInt(f.AssetVersion, 10)
+	}
+	return `"` + v + `"`
+}
+
+// setETag exposes the favourite's version so clients can send it back in If-Match.
+func setETag(w http.ResponseWriter, f *models.Favourite) {
+	w.Header().Set("ETag", etag(f))
+}
+
+// parseETags splits an If-Match/If-None-Match value into its entity tags.
+// The wildcard is reported separately; weak tags are kept with their W/ prefix.
+func parseETags(h string) (tags []string, any bool) {
+	for _, t := range strings.Split(h, ",") {
+		t = strings.TrimSpace(t)
+		switch t {
+		case "":
+		case "*":
+			any = true
+		default:
+			tags = append(tags, t)
+		}
+	}
+	return tags, any
+}
+
+// lastModified is the favourite's last change time, truncated to the one-second
+// precision of HTTP dates so it compares correctly with If-Modified-Since.
+func lastModified(f *models.Favourite) time.Time {
+	t := f.CreatedAt
+	if f.UpdatedAt != nil {
+		t = *f.UpdatedAt
+	}
+	if f.AssetUpdatedAt != nil && f.AssetUpdatedAt.After(t) {
+		t = *f.AssetUpdatedAt
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+// notModified evaluates the cache validators of a GET (RFC 9110 §13.2.2): when
+// If-None-Match is present it alone decides, using weak comparison; otherwise
+// If-Modified-Since is compared with the last modification time.
+func notModified(r *http.Request, f *models.Favourite) bool {
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		tags, any := parseETags(h)
+		if any {
+			return true
+		}
+		cur := etag(f)
+		for _, t := range tags {
+			if strings.TrimPrefix(t, "W/") == cur {
+				return true
+			}
+		}
+		return false
+	}
+	if h := r.Header.Get("If-Modified-Since"); h != "" {
+		if since, err := http.ParseTime(h); err == nil {
+			return !lastModified(f).After(since)
+		}
+	}
+	return false
+}
+
+// ifMatchVersion turns the If-Match header into the version a conditional write must observe.
+// It returns 0 (unconditional) when the header is absent, and for "*" once the favourite is
+// known to exist; a missing one fails the precondition. With several tags the current
+// version is looked up and used as the precondition if it is among them, so the write still
+// fails atomically should the favourite change in between. If-Match uses strong comparison,
+// so weak or foreign tags never match and yield errIfMatchFailed. Writes only concern the
+// favourite itself, so the asset version part of a reference's tag is not compared.
+func (s *Server) ifMatchVersion(ctx context.Context, r *http.Request, userID, favID string) (int64, error) {
+	return ifMatch(r, func() (int64, error) {
+		cur, err := s.svc.GetFavourite(ctx, userID, favID)
+		if err != nil {
+			return 0, err
+		}
+		return cur.Version, nil
+	})
+}
+
+// ifMatch implements ifMatchVersion for any versioned resource; current looks up the
+// resource's version when the header is "*" or lists several tags.
+func ifMatch(r *http.Request, current func() (int64, error)) (int64, error) {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return 0, nil
+	}
+	tags, any := parseETags(h)
+	if any {
+		_, err := current()
+		if errors.Is(err, service.ErrNotFound) {
+			return 0, errIfMatchFailed
+		}
+		return 0, err
+	}
+	var versions []int64
+	for _, t := range tags {
+		own, _, _ := strings.Cut(strings.Trim(t, `"`), "-")
+		if v, err := strconv.ParseInt(own, 10, 64); err == nil && v > 0 && strings.HasPrefix(t, `"`) {
+			versions = append(versions, v)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return 0, errIfMatchFailed
+	case 1:
+		return versions[0], nil
+	}
+	cur, err := current()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == cur {
+			return v, nil
+		}
+	}
+	return 0, errIfMatchFailed
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeyLen bounds client-supplied Idempotency-Key values.
+const maxIdempotencyKeyLen = 255
+
+var (
+	errIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request")
+	errIdempotencyInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// idempotencyEntry remembers a request made with an Idempotency-Key and, once it
+// has succeeded, the response to replay for retries.
+type idempotencyEntry struct {
+	hash    [sha256.Size]byte
+	done    bool // false while the original request is still running
+	status  int
+	etag    string
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyCache stores responses by (user, Idempotency-Key) for ttl so that client
+// retries are answered with the original response instead of being executed again.
+// Only successful responses are kept: a failed request releases its key so that the
+// retry runs for real. The cache is process-local and is lost on restart.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, entries: make(map[string]*idempotencyEntry), now: time.Now}
+}
+
+func idempotencyScope(userID, key string) string { return userID + "\x00" + key }
+
+// createHash fingerprints a create request: its body and the allow_duplicates option,
+// which changes whether the same body succeeds.
+func createHash(body []byte, allowDuplicates bool) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte(strconv.FormatBool(allowDuplicates)+"\x00"), body...))
+}
+
+// begin claims key for a request that hashes to hash. It returns the stored
+// entry when the key already holds a completed response for the same body, and
+// (nil, nil) when the caller should process the request and then complete or release it.
+func (c *idempotencyCache) begin(userID, key string, hash [sha256.Size]byte) (*idempotencyEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+
+	k := idempotencyScope(userID, key)
+	if e, ok := c.entries[k]; ok && now.Before(e.expires) {
+		switch {
+		case e.hash != hash:
+			return nil, errIdempotencyMismatch
+		case !e.done:
+			return nil, errIdempotencyInFlight
+		}
+		return e, nil
+	}
+	c.entries[k] = &idempotencyEntry{hash: hash, expires: now.Add(c.ttl)}
+	return nil, nil
+}
+
+// complete records the response of a request claimed with begin.
+func (c *idempotencyCache) complete(userID, key string, status int, etag string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[idempotencyScope(userID, key)]; ok {
+		e.done, e.status, e.etag, e.body = true, status, etag, body
+		e.expires = c.now().Add(c.ttl)
+	}
+}
+
+// release forgets a claimed key whose request failed, so a retry is processed again.
+func (c *idempotencyCache) release(userID, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[idempotencyScope(userID, key)]; ok && !e.done {
+		delete(c.entries, idempotencyScope(userID, key))
+	}
+}
+
+// sweep drops expired entries, at most once a minute. Callers must hold c.mu.
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+}
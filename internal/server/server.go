@@ -2,15 +2,28 @@
 package server
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 	"strconv"
 
+	"go.opentelemetry.io/otel"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/assets"
 	"github.com/KostasDasios/platform-go-challenge/internal/config"
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
+	"github.com/KostasDasios/platform-go-challenge/internal/metrics"
 	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
 	"github.com/KostasDasios/platform-go-challenge/internal/repo"
 	"github.com/KostasDasios/platform-go-challenge/internal/service"
 )
@@ -22,50 +35,200 @@ const (
 
 type Server struct {
 	cfg     *config.Config
+	repo    repo.Repository
 	svc     *service.Service
 	mux     *http.ServeMux
-	handler http.Handler // mux wrapped with middleware chain
+	handler http.Handler            // mux wrapped with middleware chain
+	idem    *idempotencyCache       // nil when IDEMPOTENCY_TTL is 0
+	keys    *middleware.KeyRegistry // nil when API key auth is off
+	limits  middleware.BucketStore  // rate limiter state
+	metrics *metrics.Metrics
+	log     *slog.Logger
 }
 
-// NewServer builds a Server with an in-memory repository.
-// Swap NewInMemoryRepo with a persistent implementation without touching handlers.
-func NewServer(cfg *config.Config) *Server {
-	r := repo.NewInMemoryRepo()
-	svc := service.NewService(r)
+// NewServer builds a Server backed by the repository selected in cfg.StorageBackend.
+// Handlers only depend on the Repository interface, so backends are interchangeable.
+// logger receives service events and, unless cfg.LogEnabled is off, the access log;
+// a nil logger discards everything.
+func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	r, err := openRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if hc, ok := r.(repo.HashCollisionReporter); ok {
+		for _, c := range hc.HashCollisions() {
+			logger.Warn("favourite left without content hash: duplicate content", "user_id", c.UserID, "fav_id", c.FavID, "duplicate_of", c.ExistingID)
+		}
+	}
+	catalog, err := openCatalog(cfg, r)
+	if err != nil {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	collections, err := openCollections(cfg, r)
+	if err != nil {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	backend := cmp.Or(cfg.StorageBackend, "memory")
+	svc := service.NewService(repo.Traced(r, backend))
+	svc.SetCatalog(repo.TracedAssets(catalog, backend))
+	svc.SetCollections(repo.TracedCollections(collections, backend))
+	m := metrics.New(r, svc.AssetTypes())
+	svc.SetMetrics(m)
+	svc.SetLogger(logger)
 
 	mux := http.NewServeMux()
-	s := &Server{cfg: cfg, svc: svc, mux: mux}
+	s := &Server{cfg: cfg, repo: r, svc: svc, mux: mux, metrics: m, log: logger}
+	if cfg.IdempotencyTTL > 0 {
+		s.idem = newIdempotencyCache(cfg.IdempotencyTTL)
+	}
 	s.routes()
 
 	// allow Swagger UI on 8081 for local testing
     allowed := []string{"http://localhost:8081"}
 
-	// Construct a lightweight rate limiter middleware based on environment config.
-	// Default: ~20 requests/sec per user or IP (configurable via RATE_LIMIT_MS).
-	rl := middleware.NewRateLimiter(time.Duration(cfg.RateLimitMillis) * time.Millisecond)
+	// Token-bucket rate limiter per user (or IP), with separate read and write budgets.
+	// Default: 20 reads/sec (burst 40) and 5 writes/sec (burst 10), configurable via RATE_LIMIT_*.
+	if s.limits, err = openBucketStore(cfg); err != nil {
+		s.Close()
+		return nil, err
+	}
+	rl := middleware.NewRateLimiter(s.limits,
+		middleware.Limit{Rate: cfg.RateLimitReadRPS, Burst: cfg.RateLimitReadBurst},
+		middleware.Limit{Rate: cfg.RateLimitWriteRPS, Burst: cfg.RateLimitWriteBurst},
+	)
+	rl.OnReject = m.RateLimited
+	rl.OnFailOpen = m.RateLimitFailedOpen
+
+	if s.keys, err = openKeyRegistry(cfg, logger); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// JWT auth is opt-in: without a secret or JWKS file the verifier stays nil and the middleware is a no-op.
+	var jwtv *middleware.JWTVerifier
+	if cfg.JWTEnabled() {
+		jwtv, err = middleware.NewJWTVerifier(middleware.JWTConfig{
+			HS256Secret: cfg.JWTSecret,
+			JWKSFile:    cfg.JWTJWKSFile,
+			Issuer:      cfg.JWTIssuer,
+			Audience:    cfg.JWTAudience,
+			AdminScope:  cfg.JWTAdminScope,
+		})
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	var accessLog *slog.Logger
+	if cfg.LogEnabled {
+		accessLog = logger
+	}
 
-	// Middleware chain: security headers -> request id -> logger -> body limit -> rate limiter -> routes
+	// Middleware chain: metrics -> security headers -> request id -> tracing -> log context -> logger -> body limit -> rate limiter -> auth -> deadline -> routes
 	// MaxBody set to 1MB (configurable via env) for POST/PATCH payloads.
-	s.handler = middleware.SecurityHeaders(
+	// Deadline ties the request context to WriteTimeout so slow storage calls are cancelled.
+	s.handler = middleware.Metrics(m, routeTemplate, middleware.SecurityHeaders(
 		middleware.CORS(allowed)(
-			middleware.RequestID(
-				middleware.Logger(
+			middleware.RequestID(middleware.Tracing(routeTemplate, middleware.LogContext(
+				middleware.Logger(accessLog,
 					middleware.MaxBody(cfg.MaxBodyBytes,
 						rl.Middleware(
-							middleware.APIKeyAuth(cfg.APIKey, s.mux),
+							middleware.APIKeyAuth(s.keys,
+								middleware.JWTAuth(jwtv,
+									middleware.Deadline(cfg.WriteTimeout, handlerSpans(s.mux)),
+								),
+							),
 						),
 					),
 				),
-			),
+			))),
 		),
-	)
+	))
+
+	return s, nil
+}
+
+// openRepository constructs the storage backend named in the configuration.
+func openRepository(cfg *config.Config) (repo.Repository, error) {
+	switch cfg.StorageBackend {
+	case "", "memory":
+		return repo.NewInMemoryRepo(), nil
+	case "file":
+		return repo.OpenFileRepo(cfg.DataDir, cfg.SnapshotEvery)
+	case "sqlite":
+		return repo.OpenSQLiteRepo(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// openBucketStore constructs the rate limiter state store named in the configuration.
+// "redis" shares the budgets between replicas; it must be reachable at startup.
+func openBucketStore(cfg *config.Config) (middleware.BucketStore, error) {
+	switch cfg.RateLimitBackend {
+	case "", "memory":
+		return middleware.NewMemoryBucketStore(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return middleware.OpenRedisBucketStore(ctx, cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimitBackend)
+	}
+}
+
+// openKeyRegistry loads the API key registry from cfg.APIKeysFile. The legacy API_KEY
+// becomes a single admin key named "default"; with neither set, API key auth is off.
+func openKeyRegistry(cfg *config.Config, logger *slog.Logger) (*middleware.KeyRegistry, error) {
+	switch {
+	case cfg.APIKeysFile != "":
+		return middleware.LoadKeyRegistry(cfg.APIKeysFile)
+	case strings.TrimSpace(cfg.APIKey) != "":
+		logger.Warn("API_KEY is deprecated; move the key into an API_KEYS_FILE registry")
+		return middleware.NewKeyRegistry([]middleware.APIKey{{
+			Name:   "default",
+			Hash:   sha256.Sum256([]byte(cfg.APIKey)),
+			Scopes: []string{middleware.ScopeAdmin},
+		}})
+	}
+	return nil, nil
+}
 
-	return s
+// ReloadKeys re-reads the API key registry file, e.g. after a key was added or revoked.
+func (s *Server) ReloadKeys() error {
+	if s.keys == nil {
+		return nil
+	}
+	return s.keys.Reload()
 }
 
 // Handler exposes the fully wrapped HTTP handler (mux + middleware chain).
 func (s *Server) Handler() http.Handler { return s.handler }
 
+// Close releases resources held by the storage backend (e.g. open log files)
+// and the rate limiter store (e.g. a Redis connection pool).
+func (s *Server) Close() error {
+	if c, ok := s.limits.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			s.log.Warn("closing rate limiter store failed", "err", err)
+		}
+	}
+	if c, ok := s.repo.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 func (s *Server) routes() {
 	// Liveness
 	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -73,25 +236,106 @@ func (s *Server) routes() {
 		fmt.Fprint(w, `{"status":"ok"}`)
 	})
 
-	// Readiness (for future external deps; always true for in-memory)
-	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprint(w, `{"ready":true}`)
-	})
+	// Readiness: pings the storage backend when it has an external dependency
+	s.mux.HandleFunc("/readyz", s.handleReady)
+
+	// Prometheus metrics (text exposition format)
+	s.mux.Handle("/metrics", s.metrics.Handler())
 
 	// REST endpoints:
 	//   GET    /users/{userID}/favourites
+	//   GET    /users/{userID}/favourites/{favID}
 	//   POST   /users/{userID}/favourites
 	//   PATCH  /users/{userID}/favourites/{favID}
+	//   PUT    /users/{userID}/favourites/{favID}
 	//   DELETE /users/{userID}/favourites/{favID}
+	//   POST   /users/{userID}/favourites:batch
+	//   ...    /users/{userID}/collections[/...] (see routeCollections)
+	//   GET    /users/{userID}/tags
 	s.mux.HandleFunc("/users/", s.routeUsers)
+
+	// Shared asset catalog (see routeAssets)
+	s.mux.HandleFunc("/assets", s.routeAssets)
+	s.mux.HandleFunc("/assets/", s.routeAssets)
+
+	// Anything else: a JSON 404 like every other error, instead of the mux's plain text
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
+	})
+}
+
+// routeTemplate maps a request path to the route it is served by, with path
+// parameters left as placeholders, for use as a metrics label.
+func routeTemplate(r *http.Request) string {
+	switch p := r.URL.Path; p {
+	case "/healthz", "/readyz", "/metrics", "/assets":
+		return p
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 2 && parts[0] == "assets" {
+		return "/assets/{assetID}"
+	}
+	if len(parts) < 3 || parts[0] != "users" {
+		return "other"
+	}
+	switch {
+	case len(parts) == 3 && parts[2] == "favourites":
+		return "/users/{userID}/favourites"
+	case len(parts) == 3 && parts[2] == "favourites:batch":
+		return "/users/{userID}/favourites:batch"
+	case len(parts) >= 4 && parts[2] == "favourites":
+		return "/users/{userID}/favourites/{favID}"
+	case len(parts) == 3 && parts[2] == "tags":
+		return "/users/{userID}/tags"
+	case len(parts) == 3 && parts[2] == "collections":
+		return "/users/{userID}/collections"
+	case len(parts) == 4 && parts[2] == "collections":
+		return "/users/{userID}/collections/{collectionID}"
+	case len(parts) == 5 && parts[2] == "collections" && parts[4] == "favourites":
+		return "/users/{userID}/collections/{collectionID}/favourites"
+	case len(parts) == 6 && parts[2] == "collections" && parts[4] == "favourites":
+		return "/users/{userID}/collections/{collectionID}/favourites/{favID}"
+	}
+	return "other"
+}
+
+// handlerSpans wraps h in a span per route and method, so that time spent in the
+// handler is told apart from the middleware chain within the request's server span.
+func handlerSpans(h http.Handler) http.Handler {
+	tracer := otel.Tracer("github.com/KostasDasios/platform-go-challenge/internal/server")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "handler "+r.Method+" "+routeTemplate(r))
+		defer span.End()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func (s *Server) routeUsers(w http.ResponseWriter, r *http.Request) {
-	// Expected paths: /users/{uid}/favourites[/favID]
+	// Expected paths: /users/{uid}/favourites[/favID], /users/{uid}/favourites:batch,
+	// /users/{uid}/collections[/...] and /users/{uid}/tags
 	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 && parts[0] == "users" && parts[2] == "tags" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+			return
+		}
+		s.handleListTags(w, r, parts[1])
+		return
+	}
+	if len(parts) >= 3 && parts[0] == "users" && parts[2] == "collections" {
+		s.routeCollections(w, r, parts[1], parts[3:])
+		return
+	}
+	if len(parts) == 3 && parts[0] == "users" && parts[2] == "favourites:batch" {
+		if r.Method != http.MethodPost {
+			writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
+			return
+		}
+		s.handleBatch(w, r, parts[1])
+		return
+	}
 	if len(parts) < 3 || parts[0] != "users" || parts[2] != "favourites" {
-		http.NotFound(w, r)
+		writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
 		return
 	}
 	userID := parts[1]
@@ -103,33 +347,54 @@ func (s *Server) routeUsers(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		if favID != "" {
-			http.NotFound(w, r)
+			s.handleGet(w, r, userID, favID)
 			return
 		}
 		s.handleList(w, r, userID)
 	case http.MethodPost:
 		if favID != "" {
-			http.NotFound(w, r)
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
 			return
 		}
 		s.handleCreate(w, r, userID)
 	case http.MethodPatch:
 		if favID == "" {
-			http.NotFound(w, r)
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
 			return
 		}
 		s.handlePatch(w, r, userID, favID)
+	case http.MethodPut:
+		if favID == "" {
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
+			return
+		}
+		s.handlePut(w, r, userID, favID)
 	case http.MethodDelete:
 		if favID == "" {
-			http.NotFound(w, r)
+			writeError(w, r, http.StatusNotFound, codeNotFound, "no such resource")
 			return
 		}
-		s.handleDelete(w, userID, favID)
+		s.handleDelete(w, r, userID, favID)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed here")
 	}
 }
 
+// readyTimeout bounds the storage ping so a hung database fails the probe instead of blocking it.
+const readyTimeout = 2 * time.Second
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if hc, ok := s.repo.(repo.HealthChecker); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := hc.Ping(ctx); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ready": false, "error": err.Error(), "request_id": middleware.RequestIDFromContext(r.Context())})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ready": true})
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -159,75 +424,290 @@ func (s *Server) handleList(w http.ResponseWriter, r *http.Request, userID strin
         }
     }
 
-    list, err := s.svc.ListFavourites(userID)
-    if err != nil {
-        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+    q := repo.ListQuery{Limit: limit, Offset: offset}
+    if err := parseListFilters(qs, s.svc.AssetTypes(), &q); err != nil {
+        writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
         return
     }
 
-    // Safe slice
-    start := offset
-    if start > len(list) {
-        start = len(list)
+    // cursor (takes precedence over offset); it carries its own sort order
+    if v := qs.Get("cursor"); v != "" {
+        c, err := repo.DecodeCursor(v)
+        if err != nil {
+            writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+            return
+        }
+        if qs.Get("sort") != "" && c.Sort != q.Sort {
+            writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "cursor was issued for a different sort")
+            return
+        }
+        q.Sort = c.Sort
+        q.After, q.Offset, offset = c, 0, 0
+    }
+
+    // collection narrows the list to one collection, in its manual order by default
+    var (
+        page *repo.ListPage
+        err  error
+    )
+    if cid := qs.Get("collection"); cid != "" {
+        if qs.Get("sort") == "" && q.After == nil {
+            q.Sort = repo.SortPosition
+        }
+        page, err = s.svc.ListCollectionFavourites(r.Context(), userID, cid, q)
+    } else {
+        page, err = s.svc.ListFavourites(r.Context(), userID, q)
+    }
+    if err != nil {
+        s.writeServiceError(w, r, err)
+        return
     }
-    end := start + limit
-    if end > len(list) {
-        end = len(list)
+
+    // next_cursor is null on the last page
+    var next *string
+    if page.Next != nil {
+        c := page.Next.Encode()
+        next = &c
     }
-    page := list[start:end]
 
     writeJSON(w, http.StatusOK, map[string]any{
-        "favourites": page,
-        "total":      len(list),
-        "limit":      limit,
-        "offset":     offset,
+        "favourites":  page.Items,
+        "total":       page.Total,
+        "limit":       limit,
+        "offset":      offset,
+        "next_cursor": next,
     })
 }
 
+// handleListTags returns the user's tags with how many favourites carry each.
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request, userID string) {
+	tags, err := s.svc.ListTags(r.Context(), userID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tags": tags})
+}
+
+// parseListFilters reads the type, tag, tag_match, q, created_after, created_before and
+// sort parameters. type may be repeated or comma-separated and must name a registered
+// asset type; so may tag, whose values are normalised like stored tags and must all be
+// present unless tag_match=any; timestamps are RFC 3339.
+func parseListFilters(qs url.Values, types *assets.Registry, q *repo.ListQuery) error {
+	at, err := parseTypeFilter(qs, types)
+	if err != nil {
+		return err
+	}
+	q.Types = at
+	for _, v := range qs["tag"] {
+		for _, t := range strings.Split(v, ",") {
+			tag, ok := service.NormalizeTag(t)
+			if !ok {
+				return fmt.Errorf("invalid tag %q", t)
+			}
+			q.Tags = append(q.Tags, tag)
+		}
+	}
+	switch m := qs.Get("tag_match"); m {
+	case "", "all":
+	case "any":
+		q.AnyTag = true
+	default:
+		return fmt.Errorf("invalid tag_match %q: want all or any", m)
+	}
+	q.Search = strings.TrimSpace(qs.Get("q"))
+	for name, dst := range map[string]*time.Time{"created_after": &q.CreatedAfter, "created_before": &q.CreatedBefore} {
+		if v := qs.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: want RFC 3339 timestamp", name)
+			}
+			*dst = t.UTC()
+		}
+	}
+	o, err := repo.ParseSortOrder(qs.Get("sort"))
+	if err != nil {
+		return err
+	}
+	q.Sort = o
+	return nil
+}
+
+// parseTypeFilter reads the repeatable, comma separated type parameter.
+func parseTypeFilter(qs url.Values, types *assets.Registry) ([]models.AssetType, error) {
+	var out []models.AssetType
+	for _, v := range qs["type"] {
+		for _, t := range strings.Split(v, ",") {
+			at := models.AssetType(strings.TrimSpace(t))
+			if !types.Known(at) {
+				return nil, fmt.Errorf("invalid type %q: want one of %v", t, types.Names())
+			}
+			out = append(out, at)
+		}
+	}
+	return out, nil
+}
+
+// queryBool reads an optional boolean query parameter; it is false when absent.
+func queryBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+// handleGet returns a single favourite. It honours If-None-Match and If-Modified-Since
+// so pollers receive a body-less 304 while the favourite is unchanged.
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, userID, favID string) {
+	f, err := s.svc.GetFavourite(r.Context(), userID, favID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	setETag(w, f)
+	w.Header().Set("Last-Modified", lastModified(f).Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache") // always revalidate, never serve stale
+	if notModified(r, f) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
 
+// handleCreate stores a new favourite, either embedding the given asset or referencing
+// a catalog asset by asset_id. Saving an asset the user already has is a 409 carrying
+// the existing favourite's ID, unless ?allow_duplicates=true. When the request carries an Idempotency-Key,
+// a retry with the same body replays the original 201 instead of creating a duplicate,
+// and reusing the key for a different body or allow_duplicates value is rejected with 422.
 func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request, userID string) {
+	allowDuplicates, err := queryBool(r, "allow_duplicates")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	body, err := io.ReadAll(r.Body)
 	var payload struct {
-		Asset json.RawMessage `json:"asset"`
+		Asset       json.RawMessage `json:"asset"`
+		AssetID     string          `json:"asset_id"`
+		Description *string         `json:"description"`
+		Tags        []string        `json:"tags"`
+	}
+	if err != nil || json.Unmarshal(body, &payload) != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid json body")
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json body"})
+	if payload.AssetID != "" && payload.Asset != nil {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "send either asset or asset_id",
+			Errors: []middleware.ProblemField{{Field: "asset_id", Reason: "must not be set together with asset"}}})
 		return
 	}
-	f, err := s.svc.CreateFavourite(userID, payload.Asset)
+
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" && s.idem != nil {
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key is too long")
+			return
+		}
+		prev, err := s.idem.begin(userID, key, createHash(body, allowDuplicates))
+		switch {
+		case errors.Is(err, errIdempotencyMismatch):
+			writeError(w, r, http.StatusUnprocessableEntity, codeIdempotencyReused, err.Error())
+			return
+		case errors.Is(err, errIdempotencyInFlight):
+			writeError(w, r, http.StatusConflict, codeIdempotencyBusy, err.Error())
+			return
+		case prev != nil:
+			w.Header().Set("ETag", prev.etag)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(prev.status)
+			_, _ = w.Write(prev.body)
+			return
+		}
+		defer s.idem.release(userID, key) // no-op once the response is recorded
+	}
+
+	var f *models.Favourite
+	if payload.AssetID != "" {
+		f, err = s.svc.CreateFavouriteRef(r.Context(), userID, payload.AssetID, payload.Description, payload.Tags, allowDuplicates)
+	} else {
+		f, err = s.svc.CreateFavourite(r.Context(), userID, payload.Asset, payload.Tags, allowDuplicates)
+	}
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		s.writeServiceError(w, r, err)
 		return
 	}
+	if key != "" && s.idem != nil {
+		b, _ := json.Marshal(f)
+		s.idem.complete(userID, key, http.StatusCreated, etag(f), append(b, '\n'))
+	}
+	setETag(w, f)
 	writeJSON(w, http.StatusCreated, f)
 }
 
+// handlePatch updates the description and/or the tags of a favourite; tags replace the
+// current ones.
 func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request, userID, favID string) {
 	var payload struct {
-		Description *string `json:"description"`
+		Description *string  `json:"description"`
+		Tags        []string `json:"tags"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Description == nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "description is required"})
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || (payload.Description == nil && payload.Tags == nil) {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "description or tags is required",
+			Errors: []middleware.ProblemField{{Field: "description", Reason: "is required unless tags are set"}}})
 		return
 	}
-	upd, err := s.svc.UpdateFavouriteDescription(userID, favID, *payload.Description)
+	ifVersion, err := s.ifMatchVersion(r.Context(), r, userID, favID)
 	if err != nil {
-		status := http.StatusNotFound
-		if err.Error() == "invalid path" {
-			status = http.StatusBadRequest
-		}
-		writeJSON(w, status, map[string]string{"error": err.Error()})
+		s.writeServiceError(w, r, err)
 		return
 	}
+	upd, err := s.svc.UpdateFavourite(r.Context(), userID, favID, payload.Description, payload.Tags, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	setETag(w, upd)
 	writeJSON(w, http.StatusOK, upd)
 }
 
-func (s *Server) handleDelete(w http.ResponseWriter, userID, favID string) {
-	if err := s.svc.DeleteFavourite(userID, favID); err != nil {
-		status := http.StatusNotFound
-		if err.Error() == "invalid path" {
-			status = http.StatusBadRequest
-		}
-		writeJSON(w, status, map[string]string{"error": err.Error()})
+// handlePut replaces the asset payload of a favourite, keeping its ID and created_at.
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request, userID, favID string) {
+	var payload struct {
+		Asset json.RawMessage `json:"asset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Asset == nil {
+		middleware.WriteProblem(w, r, middleware.Problem{Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: "asset is required",
+			Errors: []middleware.ProblemField{{Field: "asset", Reason: "is required"}}})
+		return
+	}
+	ifVersion, err := s.ifMatchVersion(r.Context(), r, userID, favID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	upd, err := s.svc.ReplaceFavourite(r.Context(), userID, favID, payload.Asset, ifVersion)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	setETag(w, upd)
+	writeJSON(w, http.StatusOK, upd)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, userID, favID string) {
+	ifVersion, err := s.ifMatchVersion(r.Context(), r, userID, favID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.svc.DeleteFavourite(r.Context(), userID, favID, ifVersion); err != nil {
+		s.writeServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -2,38 +2,64 @@ package server
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	"github.com/KostasDasios/platform-go-challenge/internal/config"
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
+	"github.com/KostasDasios/platform-go-challenge/internal/middleware"
 	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/service"
 )
 
 // newTestServer constructs a server configured for testing.
 // It disables logging and rate limiting, uses short timeouts, and avoids .env dependencies.
 // This allows tests to run fast, deterministically, and without external side effects.
-func newTestServer() *Server {
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
 	cfg := &config.Config{
 		Port:            "0",
 		AppEnv:          "test",
 		LogEnabled:      false,       // silence middleware logs during test runs
-		RateLimitMillis: 0,           // disable rate limiting for tests
+		RateLimitReadRPS:  0,         // disable rate limiting for tests
+		RateLimitWriteRPS: 0,
 		MaxBodyBytes:    1 << 20,     // 1 MB max body size
 		ReadTimeout:     2 * time.Second,
 		WriteTimeout:    2 * time.Second,
 		IdleTimeout:     2 * time.Second,
 		LogLevel:        "info",
 	}
-	return NewServer(cfg)
+	s, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s
 }
 
 // TestHealthz validates that the /healthz endpoint responds correctly and fast.
 // This test ensures that the service is wired up and responds to liveness probes as expected.
 func TestHealthz(t *testing.T) {
-	s := newTestServer()
+	s := newTestServer(t)
 
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	rr := httptest.NewRecorder()
@@ -49,11 +75,38 @@ func TestHealthz(t *testing.T) {
 	}
 }
 
+// TestReadyz_SQLiteBackend verifies that readiness reflects the database health.
+func TestReadyz_SQLiteBackend(t *testing.T) {
+	cfg := &config.Config{
+		StorageBackend: "sqlite",
+		SQLitePath:     filepath.Join(t.TempDir(), "favourites.db"),
+		MaxBodyBytes:   1 << 20,
+	}
+	s, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("/readyz with open db: got=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Closing the database must flip readiness to 503
+	s.Close()
+	rr = httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz with closed db: got=%d, want=%d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
 // TestFavouritesCRUD_HTTP verifies the full HTTP flow for CRUD operations on favourites.
 // It exercises POST → GET → PATCH → DELETE, ensuring that routing, validation,
 // and service integration are functioning correctly.
 func TestFavouritesCRUD_HTTP(t *testing.T) {
-	s := newTestServer()
+	s := newTestServer(t)
 	user := "kostas"
 
 	// --- CREATE ---
@@ -108,7 +161,7 @@ func TestFavouritesCRUD_HTTP(t *testing.T) {
 // TestFavourites_ListPagination_EmptyDefaults verifies that default limit/offset are applied
 // and that an empty list returns total=0 with a proper shape.
 func TestFavourites_ListPagination_EmptyDefaults(t *testing.T) {
-    s := newTestServer()
+    s := newTestServer(t)
 
     rr := httptest.NewRecorder()
     req := httptest.NewRequest(http.MethodGet, "/users/kostas/favourites", nil)
@@ -138,12 +191,12 @@ func TestFavourites_ListPagination_EmptyDefaults(t *testing.T) {
 
 // TestFavourites_ListPagination_WithData creates multiple items and asserts limit/offset slicing.
 func TestFavourites_ListPagination_WithData(t *testing.T) {
-    s := newTestServer()
+    s := newTestServer(t)
     user := "kostas"
 
     // create 5 favourites
     for i := 0; i < 5; i++ {
-        body := []byte(`{"asset":{"type":"insight","text":"x","description":"d"}}`)
+        body := []byte(fmt.Sprintf(`{"asset":{"type":"insight","text":"x%d","description":"d"}}`, i))
         req := httptest.NewRequest(http.MethodPost, "/users/"+user+"/favourites", bytes.NewReader(body))
         req.Header.Set("Content-Type", "application/json")
         rr := httptest.NewRecorder()
@@ -181,3 +234,1070 @@ func TestFavourites_ListPagination_WithData(t *testing.T) {
     }
 }
 
+
+// TestFavourites_ListCursor walks the list with next_cursor and rejects malformed cursors.
+func TestFavourites_ListCursor(t *testing.T) {
+	s := newTestServer(t)
+	user := "kostas"
+
+	for i := 0; i < 5; i++ {
+		body := []byte(fmt.Sprintf(`{"asset":{"type":"insight","text":"x%d","description":"d"}}`, i))
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/users/"+user+"/favourites", bytes.NewReader(body)))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("POST status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	seen := 0
+	url := "/users/" + user + "/favourites?limit=2"
+	for {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Favourites []models.Favourite `json:"favourites"`
+			NextCursor *string            `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		seen += len(resp.Favourites)
+		if resp.NextCursor == nil {
+			break
+		}
+		url = "/users/" + user + "/favourites?limit=2&cursor=" + *resp.NextCursor
+	}
+	if seen != 5 {
+		t.Fatalf("expected to page through 5 items, saw %d", seen)
+	}
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/"+user+"/favourites?cursor=***", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("malformed cursor: got=%d, want=%d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestFavourites_Put replaces an asset payload and checks the status mapping for failures.
+func TestFavourites_Put(t *testing.T) {
+	s := newTestServer(t)
+	user := "kostas"
+
+	rr := httptest.NewRecorder()
+	body := []byte(`{"asset":{"type":"insight","text":"old","description":"d"}}`)
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/users/"+user+"/favourites", bytes.NewReader(body)))
+	var created models.Favourite
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create: %v", err)
+	}
+
+	put := func(favID, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/users/"+user+"/favourites/"+favID, bytes.NewReader([]byte(body)))
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = put(created.ID, `{"asset":{"type":"insight","text":"new","description":"d2"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT: unexpected status %d body=%s", rr.Code, rr.Body.String())
+	}
+	var upd models.Favourite
+	if err := json.Unmarshal(rr.Body.Bytes(), &upd); err != nil {
+		t.Fatalf("unmarshal put: %v", err)
+	}
+	if upd.ID != created.ID || !upd.CreatedAt.Equal(created.CreatedAt) || upd.UpdatedAt == nil {
+		t.Fatalf("PUT must keep id/created_at and set updated_at: %+v", upd)
+	}
+
+	cases := []struct {
+		name, favID, body string
+		want              int
+	}{
+		{"invalid payload", created.ID, `{"asset":{"type":"insight","text":""}}`, http.StatusBadRequest},
+		{"missing asset", created.ID, `{}`, http.StatusBadRequest},
+		{"type change", created.ID, `{"asset":{"type":"chart","title":"t","data":[1]}}`, http.StatusConflict},
+		{"unknown favourite", "missing", `{"asset":{"type":"insight","text":"x"}}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if rr := put(tc.favID, tc.body); rr.Code != tc.want {
+			t.Fatalf("%s: got=%d want=%d body=%s", tc.name, rr.Code, tc.want, rr.Body.String())
+		}
+	}
+}
+
+// TestFavourites_IfMatch simulates two tabs editing the same favourite.
+func TestFavourites_IfMatch(t *testing.T) {
+	s := newTestServer(t)
+	base := "/users/kostas/favourites"
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, base, bytes.NewReader([]byte(`{"asset":{"type":"insight","text":"x"}}`))))
+	if rr.Code != http.StatusCreated || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("POST: status=%d etag=%q", rr.Code, rr.Header().Get("ETag"))
+	}
+	var created models.Favourite
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	item := base + "/" + created.ID
+
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, item, bytes.NewReader([]byte(`{"description":"tab"}`)))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// tab A wins with the current ETag
+	if rr := patch(`"1"`); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PATCH tab A: status=%d etag=%q", rr.Code, rr.Header().Get("ETag"))
+	}
+	// tab B still holds "1" and must be rejected
+	if rr := patch(`"1"`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH tab B: got=%d, want=412", rr.Code)
+	}
+	// any of several tags may match; "*" only requires existence
+	if rr := patch(`"7", "2"`); rr.Code != http.StatusOK {
+		t.Fatalf("PATCH with tag list: got=%d", rr.Code)
+	}
+	if rr := patch(`*`); rr.Code != http.StatusOK {
+		t.Fatalf("PATCH with wildcard: got=%d", rr.Code)
+	}
+	// weak tags never satisfy If-Match
+	if rr := patch(`W/"4"`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with weak tag: got=%d, want=412", rr.Code)
+	}
+
+	del := httptest.NewRequest(http.MethodDelete, item, nil)
+	del.Header.Set("If-Match", `"1"`)
+	rr = httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, del)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale DELETE: got=%d, want=412", rr.Code)
+	}
+	del.Header.Set("If-Match", `"4"`)
+	rr = httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, del)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE with current ETag: got=%d", rr.Code)
+	}
+	// once the favourite is gone "*" no longer matches
+	if rr := patch(`*`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH deleted with wildcard: got=%d, want=412", rr.Code)
+	}
+}
+
+// TestFavourites_GetConditional polls a single favourite with cache validators.
+func TestFavourites_GetConditional(t *testing.T) {
+	s := newTestServer(t)
+	base := "/users/kostas/favourites"
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, base, bytes.NewReader([]byte(`{"asset":{"type":"insight","text":"x"}}`))))
+	var created models.Favourite
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	item := base + "/" + created.ID
+
+	get := func(h map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, item, nil)
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = get(nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"1"` || rr.Header().Get("Last-Modified") == "" {
+		t.Fatalf("GET: status=%d headers=%v", rr.Code, rr.Header())
+	}
+	lastMod := rr.Header().Get("Last-Modified")
+
+	if rr := get(map[string]string{"If-None-Match": `"1"`}); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Fatalf("If-None-Match current: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := get(map[string]string{"If-None-Match": `W/"1"`}); rr.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match weak: status=%d", rr.Code)
+	}
+	if rr := get(map[string]string{"If-Modified-Since": lastMod}); rr.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since current: status=%d", rr.Code)
+	}
+	// If-None-Match wins over If-Modified-Since
+	if rr := get(map[string]string{"If-None-Match": `"0"`, "If-Modified-Since": lastMod}); rr.Code != http.StatusOK {
+		t.Fatalf("stale If-None-Match: status=%d", rr.Code)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if rr := get(map[string]string{"If-Modified-Since": past}); rr.Code != http.StatusOK {
+		t.Fatalf("If-Modified-Since in the past: status=%d", rr.Code)
+	}
+
+	// a modification invalidates the ETag
+	req := httptest.NewRequest(http.MethodPatch, item, bytes.NewReader([]byte(`{"description":"new"}`)))
+	s.handler.ServeHTTP(httptest.NewRecorder(), req)
+	if rr := get(map[string]string{"If-None-Match": `"1"`}); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("after PATCH: status=%d etag=%q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	rr = httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, base+"/missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("GET missing: got=%d, want=404", rr.Code)
+	}
+}
+
+// TestFavourites_ListFilters checks the filter/sort query parameters and their validation.
+func TestFavourites_ListFilters(t *testing.T) {
+	s := newTestServer(t)
+	user := "kostas"
+	for _, asset := range []string{
+		`{"type":"chart","title":"Revenue","axis_x_title":"m","axis_y_title":"v","data":[1],"description":"b"}`,
+		`{"type":"insight","text":"Revenue is up","description":"a"}`,
+		`{"type":"audience","gender":"female","age_groups":["18-24"],"description":"c"}`,
+	} {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/users/"+user+"/favourites", bytes.NewReader([]byte(`{"asset":`+asset+`}`))))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("POST status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	list := func(query string) (int, []models.Favourite) {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/"+user+"/favourites?"+query, nil))
+		var resp struct {
+			Favourites []models.Favourite `json:"favourites"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Favourites
+	}
+
+	if code, favs := list("type=chart,insight&q=revenue&sort=description"); code != http.StatusOK || len(favs) != 2 || favs[0].Description != "a" {
+		t.Fatalf("filtered list: code=%d favs=%+v", code, favs)
+	}
+	if code, favs := list("type=audience&type=chart"); code != http.StatusOK || len(favs) != 2 {
+		t.Fatalf("repeated type: code=%d favs=%+v", code, favs)
+	}
+	if code, favs := list("created_after=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)); code != http.StatusOK || len(favs) != 0 {
+		t.Fatalf("created_after in the future: code=%d favs=%+v", code, favs)
+	}
+
+	for _, bad := range []string{"type=video", "created_before=yesterday", "sort=title"} {
+		if code, _ := list(bad); code != http.StatusBadRequest {
+			t.Fatalf("%s: got=%d, want=%d", bad, code, http.StatusBadRequest)
+		}
+	}
+
+	// a cursor cannot be replayed under a different sort
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/"+user+"/favourites?limit=1&sort=description", nil))
+	var resp struct {
+		NextCursor *string `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.NextCursor == nil {
+		t.Fatalf("expected a next cursor: %s", rr.Body.String())
+	}
+	if code, _ := list("sort=created_at&cursor=" + *resp.NextCursor); code != http.StatusBadRequest {
+		t.Fatalf("cursor/sort mismatch: got=%d, want=%d", code, http.StatusBadRequest)
+	}
+	if code, favs := list("cursor=" + *resp.NextCursor); code != http.StatusOK || len(favs) != 2 || favs[0].Description != "b" {
+		t.Fatalf("cursor keeps its sort: code=%d favs=%+v", code, favs)
+	}
+}
+
+// TestFavourites_Batch covers per-item results and the all-or-nothing atomic mode.
+func TestFavourites_Batch(t *testing.T) {
+	s := newTestServer(t)
+	user := "kostas"
+	batch := func(query, body string) (int, []batchItemResult) {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/users/"+user+"/favourites:batch"+query, bytes.NewReader([]byte(body))))
+		var resp struct {
+			Results []batchItemResult `json:"results"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Results
+	}
+
+	code, res := batch("", `{"operations":[
+		{"op":"create","asset":{"type":"insight","text":"a","description":"first"}},
+		{"op":"create","asset":{"type":"insight"}},
+		{"op":"delete","id":"missing"}]}`)
+	if code != http.StatusOK || len(res) != 3 {
+		t.Fatalf("batch: code=%d results=%+v", code, res)
+	}
+	if res[0].Status != http.StatusCreated || res[0].Favourite == nil || res[1].Status != http.StatusBadRequest || res[2].Status != http.StatusNotFound {
+		t.Fatalf("unexpected per-item results: %+v", res)
+	}
+	id := res[0].Favourite.ID
+
+	// the stale if_version fails the second op, so the create must not be applied either
+	code, res = batch("?atomic=true", `{"operations":[
+		{"op":"create","asset":{"type":"insight","text":"b"}},
+		{"op":"patch","id":"`+id+`","description":"x","if_version":7}]}`)
+	if code != http.StatusPreconditionFailed || res[0].Status != http.StatusFailedDependency || res[1].Status != http.StatusPreconditionFailed {
+		t.Fatalf("atomic abort: code=%d results=%+v", code, res)
+	}
+
+	code, res = batch("?atomic=true", `{"operations":[
+		{"op":"patch","id":"`+id+`","description":"x","if_version":1},
+		{"op":"delete","id":"`+id+`","if_version":2}]}`)
+	if code != http.StatusOK || res[0].Status != http.StatusOK || res[1].Status != http.StatusNoContent {
+		t.Fatalf("atomic success: code=%d results=%+v", code, res)
+	}
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/"+user+"/favourites", nil))
+	var list struct {
+		Total int `json:"total"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if list.Total != 0 {
+		t.Fatalf("expected no favourites left, got %d", list.Total)
+	}
+
+	if code, _ := batch("?atomic=maybe", `{"operations":[]}`); code != http.StatusBadRequest {
+		t.Fatalf("invalid atomic flag: got=%d", code)
+	}
+	if code, _ := batch("", `{"operations":[]}`); code != http.StatusBadRequest {
+		t.Fatalf("empty batch: got=%d", code)
+	}
+}
+
+// TestFavourites_IdempotencyKey checks replay, request mismatch and expiry of Idempotency-Key entries.
+func TestFavourites_IdempotencyKey(t *testing.T) {
+	s := newTestServer(t)
+	s.idem = newIdempotencyCache(time.Hour)
+	now := time.Now()
+	s.idem.now = func() time.Time { return now }
+
+	postTo := func(target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader([]byte(body)))
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+	post := func(key, body string) *httptest.ResponseRecorder {
+		return postTo("/users/kostas/favourites", key, body)
+	}
+	body := `{"asset":{"type":"insight","text":"t"}}`
+
+	// a failed request does not consume the key
+	if rr := post("k1", `{"asset":{"type":"insight"}}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid asset: got=%d", rr.Code)
+	}
+	first := post("k1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first POST status=%d body=%s", first.Code, first.Body.String())
+	}
+	retry := post("k1", body)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry was not replayed: status=%d body=%s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatalf("replayed ETag %q != %q", retry.Header().Get("ETag"), first.Header().Get("ETag"))
+	}
+	if rr := post("k1", `{"asset":{"type":"insight","text":"other"}}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with another body: got=%d, want=%d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	// allow_duplicates changes the outcome of the same body, so it is part of the request too
+	if rr := postTo("/users/kostas/favourites?allow_duplicates=true", "k1", body); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with allow_duplicates: got=%d, want=%d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	// after the TTL the key is free again and the request is executed anew, which the
+	// duplicate check then rejects
+	now = now.Add(2 * time.Hour)
+	if rr := post("k1", body); rr.Code != http.StatusConflict || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expired key: status=%d replayed=%q", rr.Code, rr.Header().Get("Idempotent-Replayed"))
+	}
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/kostas/favourites", nil))
+	var list struct {
+		Total int `json:"total"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if list.Total != 1 {
+		t.Fatalf("expected only the original favourite, got %d", list.Total)
+	}
+}
+
+// TestJWTAuth checks HS256 and RS256 (JWKS) tokens, subject/path matching and the admin scope.
+func TestJWTAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","alg":"RS256","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, []byte(jwks), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+
+	cfg := &config.Config{
+		MaxBodyBytes:  1 << 20,
+		WriteTimeout:  2 * time.Second,
+		JWTSecret:     "test-secret",
+		JWTJWKSFile:   jwksPath,
+		JWTIssuer:     "https://auth.example",
+		JWTAdminScope: "admin",
+	}
+	s, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, k any, kid, sub, scope string, exp time.Duration) string {
+		tok := jwt.NewWithClaims(method, jwt.MapClaims{
+			"sub": sub, "scope": scope, "iss": "https://auth.example", "exp": time.Now().Add(exp).Unix(),
+		})
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		str, err := tok.SignedString(k)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return str
+	}
+	get := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	hs := func(sub, scope string) string { return sign(jwt.SigningMethodHS256, []byte("test-secret"), "", sub, scope, time.Hour) }
+
+	cases := []struct {
+		name, path, token string
+		want              int
+	}{
+		{"no token", "/users/kostas/favourites", "", http.StatusUnauthorized},
+		{"hs256 own user", "/users/kostas/favourites", hs("kostas", ""), http.StatusOK},
+		{"rs256 own user", "/users/kostas/favourites", sign(jwt.SigningMethodRS256, key, "k1", "kostas", "", time.Hour), http.StatusOK},
+		{"other user", "/users/maria/favourites", hs("kostas", "read"), http.StatusForbidden},
+		{"admin acts for anyone", "/users/maria/favourites", hs("ops", "read admin"), http.StatusOK},
+		{"expired", "/users/kostas/favourites", sign(jwt.SigningMethodHS256, []byte("test-secret"), "", "kostas", "", -time.Minute), http.StatusUnauthorized},
+		{"wrong secret", "/users/kostas/favourites", sign(jwt.SigningMethodHS256, []byte("nope"), "", "kostas", "", time.Hour), http.StatusUnauthorized},
+		{"unknown kid", "/users/kostas/favourites", sign(jwt.SigningMethodRS256, key, "k2", "kostas", "", time.Hour), http.StatusUnauthorized},
+		{"probes stay open", "/healthz", "", http.StatusOK},
+		{"catalog needs a token", "/assets", "", http.StatusUnauthorized},
+		{"catalog readable by any user", "/assets", hs("kostas", ""), http.StatusOK},
+	}
+	for _, c := range cases {
+		if got := get(c.path, c.token); got != c.want {
+			t.Errorf("%s: got=%d, want=%d", c.name, got, c.want)
+		}
+	}
+
+	// only the admin scope may change the shared catalog
+	for token, want := range map[string]int{hs("kostas", "write"): http.StatusForbidden, hs("ops", "admin"): http.StatusCreated} {
+		req := httptest.NewRequest(http.MethodPost, "/assets", strings.NewReader(`{"asset":{"type":"insight","text":"t"}}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("catalog write: got=%d, want=%d", rr.Code, want)
+		}
+	}
+}
+
+// TestAPIKeyRegistry checks scopes, expiry, reload and that the key name reaches the access log.
+func TestAPIKeyRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("write keys: %v", err)
+		}
+	}
+	writeKeys(fmt.Sprintf(`{"keys":[
+		{"name":"dashboard","sha256":%q,"scopes":["read"]},
+		{"name":"importer","sha256":%q,"scopes":["read","write"],"expires_at":"2999-01-01T00:00:00Z"},
+		{"name":"old","sha256":%q,"scopes":["admin"],"expires_at":"2000-01-01T00:00:00Z"}]}`,
+		middleware.HashAPIKey("r-secret"), middleware.HashAPIKey("w-secret"), middleware.HashAPIKey("old-secret")))
+
+	var logs bytes.Buffer
+	logger := logging.New(&logs, "development", "info")
+	s, err := NewServer(&config.Config{MaxBodyBytes: 1 << 20, WriteTimeout: 2 * time.Second, APIKeysFile: path, LogEnabled: true}, logger)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	do := func(method, key string) int {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = bytes.NewReader([]byte(`{"asset":{"type":"insight","text":"t"}}`))
+		}
+		req := httptest.NewRequest(method, "/users/kostas/favourites", body)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	cases := []struct {
+		method, key string
+		want        int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "nope", http.StatusUnauthorized},
+		{http.MethodGet, "old-secret", http.StatusUnauthorized},
+		{http.MethodGet, "r-secret", http.StatusOK},
+		{http.MethodPost, "r-secret", http.StatusForbidden},
+		{http.MethodPost, "w-secret", http.StatusCreated},
+	}
+	for _, c := range cases {
+		if got := do(c.method, c.key); got != c.want {
+			t.Errorf("%s with %q: got=%d, want=%d", c.method, c.key, got, c.want)
+		}
+	}
+	if !strings.Contains(logs.String(), "status=201") || !strings.Contains(logs.String(), "key_name=importer") || strings.Contains(logs.String(), "w-secret") {
+		t.Fatalf("access log does not name the key:\n%s", logs.String())
+	}
+
+	// rotation: the dashboard key is revoked and its successor becomes valid without a restart
+	writeKeys(fmt.Sprintf(`{"keys":[{"name":"dashboard-2","sha256":%q,"scopes":["read"]}]}`, middleware.HashAPIKey("r2-secret")))
+	if err := s.ReloadKeys(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := do(http.MethodGet, "r-secret"); got != http.StatusUnauthorized {
+		t.Fatalf("revoked key: got=%d", got)
+	}
+	if got := do(http.MethodGet, "r2-secret"); got != http.StatusOK {
+		t.Fatalf("new key: got=%d", got)
+	}
+
+	// a broken file keeps the previous keys active
+	writeKeys(`{"keys":[{"name":"x","sha256":"zz","scopes":["read"]}]}`)
+	if err := s.ReloadKeys(); err == nil {
+		t.Fatalf("expected reload error for an invalid hash")
+	}
+	if got := do(http.MethodGet, "r2-secret"); got != http.StatusOK {
+		t.Fatalf("keys lost after failed reload: got=%d", got)
+	}
+}
+
+// TestMetrics checks that /metrics reports requests by route template (never by user),
+// rate limit rejections, validation failures by asset type and the stored counts.
+func TestMetrics(t *testing.T) {
+	s, err := NewServer(&config.Config{MaxBodyBytes: 1 << 20, WriteTimeout: 2 * time.Second, RateLimitWriteRPS: 1, RateLimitWriteBurst: 3}, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	do := func(method, path, body string) int {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr.Code
+	}
+	steps := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"chart","title":"t","data":[1]}}`, http.StatusCreated},
+		{http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"chart","title":"t"}}`, http.StatusBadRequest},
+		{http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"kostas-secret"}}`, http.StatusBadRequest},
+		{http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"insight","text":"x"}}`, http.StatusTooManyRequests},
+		{http.MethodGet, "/users/kostas/favourites/nope", "", http.StatusNotFound},
+	}
+	for i, st := range steps {
+		if got := do(st.method, st.path, st.body); got != st.want {
+			t.Fatalf("step %d: got=%d, want=%d", i, got, st.want)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("/metrics status=%d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`http_requests_total{method="POST",route="/users/{userID}/favourites",status="201"} 1`,
+		`http_requests_total{method="POST",route="/users/{userID}/favourites",status="400"} 2`,
+		`http_requests_total{method="GET",route="/users/{userID}/favourites/{favID}",status="404"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/users/{userID}/favourites",status="429"} 1`,
+		`rate_limit_rejections_total{class="write"} 1`,
+		`asset_validation_failures_total{asset_type="chart"} 1`,
+		`asset_validation_failures_total{asset_type="unknown"} 1`,
+		`favourites_stored{asset_type="chart"} 1`,
+		`favourites_stored{asset_type="insight"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	if strings.Contains(body, "kostas") {
+		t.Errorf("metrics leak user ids or client input:\n%s", body)
+	}
+}
+
+// TestTracing checks that an inbound traceparent is continued through the middleware,
+// handler, service and repository spans, and that the trace is correlated with the
+// request ID and the log lines.
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var logs bytes.Buffer
+	s, err := NewServer(&config.Config{MaxBodyBytes: 1 << 20, WriteTimeout: 2 * time.Second, LogEnabled: true},
+		logging.New(&logs, "development", "info"))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/users/kostas/favourites", strings.NewReader(`{"asset":{"type":"insight","text":"t"}}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d", rr.Code)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, sp := range rec.Ended() {
+		if sp.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %q is not in the caller's trace", sp.Name())
+		}
+		spans[sp.Name()] = sp
+	}
+	for _, name := range []string{"POST /users/{userID}/favourites", "handler POST /users/{userID}/favourites", "Service.CreateFavourite", "Service.validate", "repo.Create"} {
+		if spans[name] == nil {
+			t.Fatalf("missing span %q (have %v)", name, slices.Collect(maps.Keys(spans)))
+		}
+	}
+	server := spans["POST /users/{userID}/favourites"]
+	if server.Parent().SpanID().String() != parentID {
+		t.Errorf("server span parent = %s, want %s", server.Parent().SpanID(), parentID)
+	}
+	if spans["repo.Create"].Parent().SpanID() != spans["Service.CreateFavourite"].SpanContext().SpanID() {
+		t.Errorf("repo span is not a child of the service span")
+	}
+	var reqID string
+	for _, a := range server.Attributes() {
+		if a.Key == "http.request.id" {
+			reqID = a.Value.AsString()
+		}
+	}
+	if reqID == "" || reqID != rr.Header().Get("X-Request-ID") {
+		t.Errorf("server span request id = %q, response has %q", reqID, rr.Header().Get("X-Request-ID"))
+	}
+	if !strings.Contains(logs.String(), "trace_id="+traceID) {
+		t.Errorf("log lines lack the trace id:\n%s", logs.String())
+	}
+}
+
+// TestErrorBodies_RequestID checks that errors from handlers, routing and middleware
+// all carry the request ID, and that an inbound ID from the gateway is kept.
+func TestErrorBodies_RequestID(t *testing.T) {
+	s, err := NewServer(&config.Config{MaxBodyBytes: 1 << 20, WriteTimeout: 2 * time.Second, APIKey: "k"}, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	cases := []struct {
+		name, method, path, body, key string
+		want                          int
+	}{
+		{"handler", http.MethodPost, "/users/kostas/favourites", `{`, "k", http.StatusBadRequest},
+		{"routing", http.MethodGet, "/nowhere", "", "k", http.StatusNotFound},
+		{"method", http.MethodGet, "/users/kostas/favourites:batch", "", "k", http.StatusMethodNotAllowed},
+		{"middleware", http.MethodGet, "/users/kostas/favourites", "", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		req.Header.Set("X-API-Key", c.key)
+		req.Header.Set("X-Request-ID", "gw-"+c.name)
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		var body middleware.Problem
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != c.want || body.Status != c.want || body.Code == "" || body.RequestID != "gw-"+c.name {
+			t.Errorf("%s: status=%d body=%s", c.name, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Request-ID") != "gw-"+c.name {
+			t.Errorf("%s: response header X-Request-ID=%q", c.name, rr.Header().Get("X-Request-ID"))
+		}
+	}
+}
+
+// TestProblemDetails checks that service errors become problem+json responses with
+// stable codes and, for invalid assets, one entry per invalid field.
+func TestProblemDetails(t *testing.T) {
+	s := newTestServer(t)
+	do := func(method, path, body string) (*httptest.ResponseRecorder, middleware.Problem) {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var p middleware.Problem
+		if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s %s: Content-Type=%q body=%s", method, path, ct, rr.Body.String())
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return rr, p
+	}
+
+	rr, p := do(http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"chart","data":[]}}`)
+	want := []middleware.ProblemField{{Field: "asset.data", Reason: "must not be empty"}, {Field: "asset.title", Reason: "is required"}}
+	if rr.Code != http.StatusBadRequest || p.Code != service.CodeInvalidAsset || p.Type != middleware.ProblemTypePrefix+service.CodeInvalidAsset ||
+		p.Instance != "/users/kostas/favourites" || !reflect.DeepEqual(p.Errors, want) {
+		t.Fatalf("invalid chart: status=%d problem=%+v", rr.Code, p)
+	}
+	if _, p = do(http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"chart","title":1,"data":[1]}}`); p.Errors[0].Field != "asset.title" {
+		t.Fatalf("mistyped field: %+v", p)
+	}
+
+	cases := []struct {
+		name, method, path, body, code string
+		status                         int
+	}{
+		{"bad user", http.MethodGet, "/users/b%20d/favourites", "", service.CodeInvalidUserID, http.StatusBadRequest},
+		{"unknown favourite", http.MethodGet, "/users/kostas/favourites/missing", "", service.CodeFavNotFound, http.StatusNotFound},
+		{"unknown type", http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"map"}}`, service.CodeInvalidAsset, http.StatusBadRequest},
+		{"empty batch", http.MethodPost, "/users/kostas/favourites:batch", `{"operations":[]}`, service.CodeInvalidBatch, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if rr, p := do(c.method, c.path, c.body); rr.Code != c.status || p.Code != c.code {
+			t.Errorf("%s: status=%d problem=%+v", c.name, rr.Code, p)
+		}
+	}
+}
+
+// TestAssetCatalog shares one catalog asset between favourites: updates to the asset
+// show up in every favourite referencing it and a deleted asset resolves to null.
+func TestAssetCatalog(t *testing.T) {
+	s := newTestServer(t)
+	do := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		var rd io.Reader
+		if body != "" {
+			rd = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, rd)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+	problemCode := func(rr *httptest.ResponseRecorder) string {
+		var p middleware.Problem
+		_ = json.Unmarshal(rr.Body.Bytes(), &p)
+		return p.Code
+	}
+
+	rr := do(http.MethodPost, "/assets", "", `{"asset":{"type":"insight","text":"Shared","description":"from catalog"}}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("create asset: status=%d etag=%q body=%s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	var asset models.Asset
+	json.Unmarshal(rr.Body.Bytes(), &asset)
+
+	base := "/users/kostas/favourites"
+	rr = do(http.MethodPost, base, "", `{"asset_id":"`+asset.ID+`"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("ETag") != `"1-1"` {
+		t.Fatalf("create reference: status=%d etag=%q body=%s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	var ref models.Favourite
+	json.Unmarshal(rr.Body.Bytes(), &ref)
+	if ref.AssetID != asset.ID || ref.Type != models.AssetInsight || ref.Description != "from catalog" || string(ref.Asset) != string(asset.Data) {
+		t.Fatalf("reference = %+v", ref)
+	}
+	do(http.MethodPost, "/users/maria/favourites", "", `{"asset_id":"`+asset.ID+`","description":"mine"}`)
+
+	for name, tc := range map[string]struct {
+		body, code string
+	}{
+		"both":          {`{"asset_id":"` + asset.ID + `","asset":{"type":"insight","text":"x"}}`, codeInvalidRequest},
+		"unknown asset": {`{"asset_id":"missing"}`, service.CodeInvalidAssetID},
+	} {
+		if rr := do(http.MethodPost, base, "", tc.body); rr.Code != http.StatusBadRequest || problemCode(rr) != tc.code {
+			t.Errorf("%s: status=%d body=%s", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	item := "/assets/" + asset.ID
+	if rr := do(http.MethodPut, item, `"1"`, `{"asset":{"type":"chart","title":"t","data":[1]}}`); rr.Code != http.StatusConflict {
+		t.Fatalf("asset type change: got=%d", rr.Code)
+	}
+	if rr := do(http.MethodPut, item, `"1"`, `{"asset":{"type":"insight","text":"Updated"}}`); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("update asset: status=%d etag=%q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	for _, user := range []string{"kostas", "maria"} {
+		rr = do(http.MethodGet, "/users/"+user+"/favourites", "", "")
+		var list struct{ Favourites []models.Favourite }
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		if len(list.Favourites) != 1 || list.Favourites[0].AssetVersion != 2 || !strings.Contains(string(list.Favourites[0].Asset), "Updated") {
+			t.Fatalf("%s sees %s", user, rr.Body.String())
+		}
+	}
+
+	refItem := base + "/" + ref.ID
+	if rr := do(http.MethodPut, refItem, "", `{"asset":{"type":"insight","text":"x"}}`); rr.Code != http.StatusConflict || problemCode(rr) != service.CodeFavIsReference {
+		t.Fatalf("PUT reference: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// the favourite's own version decides If-Match, whatever asset version the client saw
+	if rr := do(http.MethodPatch, refItem, `"1-1"`, `{"description":"renamed"}`); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2-2"` {
+		t.Fatalf("PATCH reference: status=%d etag=%q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	rr = do(http.MethodGet, "/assets?type=insight", "", "")
+	if !strings.Contains(rr.Body.String(), `"total":1`) {
+		t.Fatalf("list assets: %s", rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/assets?type=chart", "", ""); !strings.Contains(rr.Body.String(), `"total":0`) {
+		t.Fatalf("list assets by type: %s", rr.Body.String())
+	}
+	for _, q := range []string{"q=foo", "sort=-updated_at", "tag=x"} {
+		if rr := do(http.MethodGet, "/assets?"+q, "", ""); rr.Code != http.StatusBadRequest || problemCode(rr) != codeInvalidRequest {
+			t.Fatalf("list assets with %s: status=%d body=%s", q, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := do(http.MethodDelete, item, `"1"`, ""); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale asset delete: got=%d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, item, `"2"`, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("asset delete: got=%d", rr.Code)
+	}
+	if rr := do(http.MethodGet, item, "", ""); rr.Code != http.StatusNotFound || problemCode(rr) != service.CodeAssetNotFound {
+		t.Fatalf("deleted asset: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = do(http.MethodGet, refItem, "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"asset":null`) || rr.Header().Get("ETag") != `"2-0"` {
+		t.Fatalf("dangling reference: status=%d etag=%q body=%s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+}
+
+// TestFavourites_Duplicates checks the 409 for an asset the user already has and the
+// allow_duplicates opt-out, for single creates and batches.
+func TestFavourites_Duplicates(t *testing.T) {
+	s := newTestServer(t)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post("/users/kostas/favourites", `{"asset":{"type":"insight","text":"t","description":"d"}}`)
+	var first models.Favourite
+	if err := json.Unmarshal(rr.Body.Bytes(), &first); rr.Code != http.StatusCreated || err != nil {
+		t.Fatalf("create: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = post("/users/kostas/favourites", `{"asset":{"text":"t","type":"insight"}}`)
+	var p middleware.Problem
+	_ = json.Unmarshal(rr.Body.Bytes(), &p)
+	if rr.Code != http.StatusConflict || p.Code != service.CodeDuplicateFav || p.ExistingID != first.ID {
+		t.Fatalf("duplicate: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/users/kostas/favourites?allow_duplicates=true", `{"asset":{"type":"insight","text":"t"}}`); rr.Code != http.StatusCreated {
+		t.Fatalf("allowed duplicate: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/users/kostas/favourites?allow_duplicates=maybe", `{"asset":{"type":"insight","text":"t"}}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid allow_duplicates: status=%d", rr.Code)
+	}
+
+	ops := `{"operations":[{"op":"create","asset":{"type":"insight","text":"t"}}]}`
+	rr = post("/users/kostas/favourites:batch", ops)
+	var res struct {
+		Results []batchItemResult `json:"results"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != http.StatusOK || res.Results[0].Status != http.StatusConflict || res.Results[0].ExistingID != first.ID {
+		t.Fatalf("batch duplicate: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/users/kostas/favourites:batch?allow_duplicates=true", ops); !strings.Contains(rr.Body.String(), `"status":201`) {
+		t.Fatalf("batch allowed duplicate: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestCollections covers the collection endpoints and listing favourites by collection.
+func TestCollections(t *testing.T) {
+	s := newTestServer(t)
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var ids []string
+	for _, text := range []string{"a", "b", "c"} {
+		rr := do(http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"insight","text":"`+text+`"}}`)
+		var f models.Favourite
+		if err := json.Unmarshal(rr.Body.Bytes(), &f); rr.Code != http.StatusCreated || err != nil {
+			t.Fatalf("create: status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		ids = append(ids, f.ID)
+	}
+
+	rr := do(http.MethodPost, "/users/kostas/collections", `{"name":"Reading","favourite_ids":["`+ids[2]+`","`+ids[0]+`"]}`)
+	var c models.Collection
+	if err := json.Unmarshal(rr.Body.Bytes(), &c); rr.Code != http.StatusCreated || err != nil || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("create collection: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	base := "/users/kostas/collections/" + c.ID
+	var p middleware.Problem
+	rr = do(http.MethodPost, "/users/kostas/collections", `{"name":"Bad","favourite_ids":["nope"]}`)
+	_ = json.Unmarshal(rr.Body.Bytes(), &p)
+	if rr.Code != http.StatusBadRequest || p.Code != service.CodeInvalidCollection {
+		t.Fatalf("unknown member: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := do(http.MethodPatch, base, `{"name":"Renamed"}`, "If-Match", `"1"`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"Renamed"`) {
+		t.Fatalf("rename: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPatch, base, `{"name":"Again"}`, "If-Match", `"1"`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale rename: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodPost, base+"/favourites", `{"favourite_id":"`+ids[1]+`","position":0}`); rr.Code != http.StatusOK {
+		t.Fatalf("add: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	list := func(query string) (got []string, next *string) {
+		t.Helper()
+		rr := do(http.MethodGet, "/users/kostas/favourites?collection="+c.ID+query, "")
+		var body struct {
+			Favourites []models.Favourite `json:"favourites"`
+			Next       *string            `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); rr.Code != http.StatusOK || err != nil {
+			t.Fatalf("list %s: status=%d body=%s", query, rr.Code, rr.Body.String())
+		}
+		for _, f := range body.Favourites {
+			got = append(got, f.ID)
+		}
+		return got, body.Next
+	}
+	got, next := list("&limit=2")
+	if want := []string{ids[1], ids[2]}; !reflect.DeepEqual(got, want) || next == nil {
+		t.Fatalf("first page = %v (next %v), want %v", got, next, want)
+	}
+	if got, next = list("&limit=2&cursor=" + *next); !reflect.DeepEqual(got, []string{ids[0]}) || next != nil {
+		t.Fatalf("second page = %v (next %v)", got, next)
+	}
+	if got, _ = list("&sort=-created_at"); !reflect.DeepEqual(got, []string{ids[2], ids[1], ids[0]}) {
+		t.Fatalf("by created_at = %v", got)
+	}
+	if rr := do(http.MethodGet, "/users/kostas/favourites?sort=position", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("position without collection: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/kostas/favourites?collection=missing", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown collection: status=%d", rr.Code)
+	}
+
+	if rr := do(http.MethodPut, base+"/favourites", `{"favourite_ids":["`+ids[0]+`","`+ids[1]+`"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("reorder: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodDelete, base+"/favourites/"+ids[1], ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("remove: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodDelete, base+"/favourites/"+ids[1], ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("remove again: status=%d", rr.Code)
+	}
+
+	if rr := do(http.MethodDelete, base+"?cascade=true", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("cascade delete: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, base, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("deleted collection: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/kostas/favourites/"+ids[0], ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("cascaded favourite: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/kostas/favourites/"+ids[1], ""); rr.Code != http.StatusOK {
+		t.Fatalf("favourite outside the collection: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/kostas/collections", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"collections":[]`) {
+		t.Fatalf("list collections: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestFavourites_Tags covers tags on create and patch, the tag filter and the tag counts.
+func TestFavourites_Tags(t *testing.T) {
+	s := newTestServer(t)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	var ids []string
+	for i, tags := range []string{`["Sales","q1"]`, `["sales"]`, `["Q1 Plan"]`} {
+		rr := do(http.MethodPost, "/users/kostas/favourites", fmt.Sprintf(`{"asset":{"type":"insight","text":"t%d"},"tags":%s}`, i, tags))
+		var f models.Favourite
+		if err := json.Unmarshal(rr.Body.Bytes(), &f); rr.Code != http.StatusCreated || err != nil {
+			t.Fatalf("create: status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		ids = append(ids, f.ID)
+	}
+	rr := do(http.MethodPost, "/users/kostas/favourites", `{"asset":{"type":"insight","text":"x"},"tags":["a/b"]}`)
+	var p middleware.Problem
+	_ = json.Unmarshal(rr.Body.Bytes(), &p)
+	if rr.Code != http.StatusBadRequest || p.Code != service.CodeInvalidTags || len(p.Errors) != 1 || p.Errors[0].Field != "tags[0]" {
+		t.Fatalf("invalid tag: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = do(http.MethodPatch, "/users/kostas/favourites/"+ids[1], `{"tags":["sales","Q1"]}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"tags":["q1","sales"]`) {
+		t.Fatalf("patch tags: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPatch, "/users/kostas/favourites/"+ids[1], `{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("empty patch: status=%d", rr.Code)
+	}
+
+	list := func(query string) []string {
+		t.Helper()
+		rr := do(http.MethodGet, "/users/kostas/favourites?sort=created_at&"+query, "")
+		var body struct {
+			Favourites []models.Favourite `json:"favourites"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); rr.Code != http.StatusOK || err != nil {
+			t.Fatalf("list %s: status=%d body=%s", query, rr.Code, rr.Body.String())
+		}
+		got := make([]string, 0)
+		for _, f := range body.Favourites {
+			got = append(got, f.ID)
+		}
+		return got
+	}
+	if got := list("tag=SALES&tag=q1"); !reflect.DeepEqual(got, ids[:2]) {
+		t.Fatalf("tag AND = %v", got)
+	}
+	if got := list("tag=q1-plan,sales&tag_match=any"); !reflect.DeepEqual(got, ids) {
+		t.Fatalf("tag OR = %v", got)
+	}
+	for _, query := range []string{"tag=a/b", "tag=q1&tag_match=some"} {
+		if rr := do(http.MethodGet, "/users/kostas/favourites?"+query, ""); rr.Code != http.StatusBadRequest {
+			t.Fatalf("list %s: status=%d", query, rr.Code)
+		}
+	}
+
+	rr = do(http.MethodGet, "/users/kostas/tags", "")
+	if want := `{"tags":[{"tag":"q1","count":2},{"tag":"sales","count":2},{"tag":"q1-plan","count":1}]}`; rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != want {
+		t.Fatalf("tags: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/users/kostas/tags", ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST tags: status=%d", rr.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// SetCatalog makes the service keep the shared asset catalog in c instead of the
+// in-memory catalog it starts with.
+func (s *Service) SetCatalog(c repo.AssetRepository) { s.catalog = c }
+
+// checkAssetID validates the ID addressing a single catalog asset.
+func checkAssetID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return validationError(CodeInvalidAssetID, "invalid asset id", FieldError{"assetID", "is required"})
+	}
+	return nil
+}
+
+// ListAssets returns one page of the asset catalog, newest first.
+func (s *Service) ListAssets(ctx context.Context, q repo.AssetQuery) (_ *repo.AssetPage, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListAssets")
+	defer func() { endSpan(span, err) }()
+	page, err := s.catalog.ListAssets(ctx, q)
+	return page, catalogFromRepo(err)
+}
+
+// GetAsset returns a single catalog asset by id.
+func (s *Service) GetAsset(ctx context.Context, id string) (_ *models.Asset, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetAsset")
+	defer func() { endSpan(span, err) }()
+	if err := checkAssetID(id); err != nil {
+		return nil, err
+	}
+	a, err := s.catalog.GetAsset(ctx, id)
+	return a, catalogFromRepo(err)
+}
+
+// CreateAsset validates the raw asset payload like CreateFavourite does and adds it to the catalog.
+func (s *Service) CreateAsset(ctx context.Context, raw json.RawMessage) (_ *models.Asset, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateAsset")
+	defer func() { endSpan(span, err) }()
+	info, err := s.validate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	a := &models.Asset{
+		ID:          newID(),
+		Type:        info.Type,
+		Description: info.Description,
+		Data:        raw,
+		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+	}
+	if err := s.catalog.CreateAsset(ctx, a); err != nil {
+		return nil, catalogFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "asset created", "asset_id", a.ID, "type", a.Type)
+	return a, nil
+}
+
+// ReplaceAsset re-validates a full asset payload and replaces the catalog entry; every
+// favourite referencing it shows the new payload from then on, and list searches match
+// its new title or text. The asset type must not change. A non-zero ifVersion makes the
+// replacement conditional.
+func (s *Service) ReplaceAsset(ctx context.Context, id string, raw json.RawMessage, ifVersion int64) (_ *models.Asset, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ReplaceAsset")
+	defer func() { endSpan(span, err) }()
+	if err := checkAssetID(id); err != nil {
+		return nil, err
+	}
+	info, err := s.validate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.catalog.GetAsset(ctx, id)
+	if err != nil {
+		return nil, catalogFromRepo(err)
+	}
+	if ifVersion != 0 && cur.Version != ifVersion {
+		return nil, catalogFromRepo(repo.ErrVersionMismatch)
+	}
+	if cur.Type != info.Type {
+		return nil, assetTypeChanged(string(cur.Type), string(info.Type))
+	}
+	a, err := s.catalog.UpdateAsset(ctx, id, repo.AssetUpdate{
+		Data:        raw,
+		Description: info.Description,
+		UpdatedAt:   time.Now().UTC(),
+		IfVersion:   ifVersion,
+	})
+	if err != nil {
+		return nil, catalogFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "asset replaced", "asset_id", id, "version", a.Version)
+	if n, err := s.repo.SetReferenceSearchText(ctx, id, info.SearchText); err != nil {
+		s.log.WarnContext(ctx, "refreshing the search text of references failed", "asset_id", id, "err", err)
+	} else if n > 0 {
+		s.log.DebugContext(ctx, "references refreshed", "asset_id", id, "favourites", n)
+	}
+	return a, nil
+}
+
+// DeleteAsset removes an asset from the catalog. Favourites referencing it are kept and
+// resolve to a null asset. A non-zero ifVersion makes the delete conditional.
+func (s *Service) DeleteAsset(ctx context.Context, id string, ifVersion int64) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteAsset")
+	defer func() { endSpan(span, err) }()
+	if err := checkAssetID(id); err != nil {
+		return err
+	}
+	if err := s.catalog.DeleteAsset(ctx, id, ifVersion); err != nil {
+		return catalogFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "asset deleted", "asset_id", id)
+	return nil
+}
+
+// newReference builds a favourite that references the catalog asset assetID, ready to be
+// stored. The description defaults to the asset's. Type and search text are copied from
+// the asset, so list filters keep running in the repository; ReplaceAsset refreshes the
+// search text.
+func (s *Service) newReference(ctx context.Context, assetID string, description *string) (*models.Favourite, error) {
+	a, err := s.catalog.GetAsset(ctx, assetID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, validationError(CodeInvalidAssetID, "unknown asset", FieldError{"asset_id", "must reference an existing asset"})
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &models.Favourite{
+		ID:          newID(),
+		Type:        a.Type,
+		Description: a.Description,
+		AssetID:     a.ID,
+		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+		ContentHash: repo.ReferenceHash(a.ID),
+	}
+	if description != nil {
+		f.Description = *description
+	}
+	// The asset was validated when it entered the catalog; only its search text is needed.
+	if info, err := validateAsset(s.types, a.Data); err == nil {
+		f.SearchText = info.SearchText
+	}
+	return f, nil
+}
+
+// resolve fills in the catalog asset of every favourite in favs that references one,
+// fetching all of them in a single call. Such favourites are replaced by resolved copies
+// rather than modified, as repositories may hand out the values they store. A reference
+// to a deleted asset resolves to a null asset.
+func (s *Service) resolve(ctx context.Context, favs []*models.Favourite) error {
+	var ids []string
+	for _, f := range favs {
+		if f != nil && f.AssetID != "" {
+			ids = append(ids, f.AssetID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	found, err := s.catalog.GetAssets(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i, f := range favs {
+		if f == nil || f.AssetID == "" {
+			continue
+		}
+		c := *f
+		c.Asset, c.AssetVersion, c.AssetUpdatedAt = nil, 0, nil
+		if a, ok := found[f.AssetID]; ok {
+			changed := a.CreatedAt
+			if a.UpdatedAt != nil {
+				changed = *a.UpdatedAt
+			}
+			c.Asset, c.AssetVersion, c.AssetUpdatedAt = a.Data, a.Version, &changed
+		}
+		favs[i] = &c
+	}
+	return nil
+}
+
+// resolveOne is resolve for a single favourite.
+func (s *Service) resolveOne(ctx context.Context, f *models.Favourite) (*models.Favourite, error) {
+	favs := []*models.Favourite{f}
+	if err := s.resolve(ctx, favs); err != nil {
+		return nil, err
+	}
+	return favs[0], nil
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// Per-user limits on collections.
+const (
+	MaxCollections        = 100  // collections per user
+	MaxCollectionSize     = 1000 // favourites per collection
+	MaxCollectionNameLen  = 100  // characters
+	membershipEditRetries = 3    // compare-and-swap attempts of unconditional membership edits
+)
+
+// SetCollections makes the service keep collections in c instead of the in-memory
+// store it starts with.
+func (s *Service) SetCollections(c repo.CollectionRepository) { s.collections = c }
+
+// checkCollectionPath validates the user and collection IDs addressing a collection.
+func (s *Service) checkCollectionPath(userID, id string) error {
+	if !s.ValidateUserID(userID) {
+		return invalidUserID()
+	}
+	if strings.TrimSpace(id) == "" {
+		return validationError(CodeInvalidCollectionID, "invalid collection id", FieldError{"collectionID", "is required"})
+	}
+	return nil
+}
+
+// collectionName trims a collection name and checks its length.
+func collectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxCollectionNameLen {
+		return "", validationError(CodeInvalidCollection, "invalid collection name",
+			FieldError{"name", fmt.Sprintf("must be 1-%d characters", MaxCollectionNameLen)})
+	}
+	return name, nil
+}
+
+// checkMembers validates an ordered list of favourite IDs for a collection: within the
+// size limit, without repeats and naming only the user's own favourites. field is
+// the request field holding the list.
+func (s *Service) checkMembers(ctx context.Context, userID string, favIDs []string, field string) error {
+	if len(favIDs) > MaxCollectionSize {
+		return limitExceeded(field, MaxCollectionSize, "favourites per collection")
+	}
+	var fields []FieldError
+	seen := make(map[string]bool, len(favIDs))
+	for i, id := range favIDs {
+		if seen[id] {
+			fields = append(fields, FieldError{fmt.Sprintf("%s[%d]", field, i), "is listed twice"})
+		}
+		seen[id] = true
+	}
+	if fields != nil {
+		return validationError(CodeInvalidCollection, "invalid collection members", fields...)
+	}
+	if len(favIDs) == 0 {
+		return nil
+	}
+	page, err := s.repo.List(ctx, userID, repo.ListQuery{IDs: favIDs})
+	if err != nil {
+		return fromRepo(err)
+	}
+	found := make(map[string]bool, len(page.Items))
+	for _, f := range page.Items {
+		found[f.ID] = true
+	}
+	for i, id := range favIDs {
+		if !found[id] {
+			name := field
+			if field != "favourite_id" {
+				name = fmt.Sprintf("%s[%d]", field, i)
+			}
+			fields = append(fields, FieldError{name, "must be one of the user's favourites"})
+		}
+	}
+	if fields != nil {
+		return validationError(CodeInvalidCollection, "unknown favourite", fields...)
+	}
+	return nil
+}
+
+// ListCollections returns all of a user's collections, oldest first.
+func (s *Service) ListCollections(ctx context.Context, userID string) (_ []*models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListCollections")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	cs, err := s.collections.ListCollections(ctx, userID)
+	return cs, collectionFromRepo(err)
+}
+
+// CreateCollection adds a named collection, optionally with initial members in order.
+func (s *Service) CreateCollection(ctx context.Context, userID, name string, favIDs []string) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateCollection")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	if name, err = collectionName(name); err != nil {
+		return nil, err
+	}
+	if err := s.checkMembers(ctx, userID, favIDs, "favourite_ids"); err != nil {
+		return nil, err
+	}
+	existing, err := s.collections.ListCollections(ctx, userID)
+	if err != nil {
+		return nil, collectionFromRepo(err)
+	}
+	if len(existing) >= MaxCollections {
+		return nil, limitExceeded("name", MaxCollections, "collections")
+	}
+	c := &models.Collection{
+		ID:           newID(),
+		Name:         name,
+		FavouriteIDs: append(make([]string, 0, len(favIDs)), favIDs...),
+		CreatedAt:    time.Now().UTC(),
+		Version:      1,
+	}
+	if err := s.collections.CreateCollection(ctx, userID, c); err != nil {
+		return nil, collectionFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "collection created", "collection_id", c.ID, "favourites", len(c.FavouriteIDs))
+	return c, nil
+}
+
+// GetCollection returns a single collection with its members in order.
+func (s *Service) GetCollection(ctx context.Context, userID, id string) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetCollection")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	c, err := s.collections.GetCollection(ctx, userID, id)
+	return c, collectionFromRepo(err)
+}
+
+// RenameCollection changes a collection's name. A non-zero ifVersion makes it conditional.
+func (s *Service) RenameCollection(ctx context.Context, userID, id, name string, ifVersion int64) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.RenameCollection")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	if name, err = collectionName(name); err != nil {
+		return nil, err
+	}
+	c, err := s.collections.UpdateCollection(ctx, userID, id, repo.CollectionUpdate{Name: &name, UpdatedAt: time.Now().UTC(), IfVersion: ifVersion})
+	if err != nil {
+		return nil, collectionFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "collection renamed", "collection_id", id, "version", c.Version)
+	return c, nil
+}
+
+// SetCollectionFavourites replaces a collection's members with favIDs, in that order;
+// it is how clients reorder a collection. A non-zero ifVersion makes it conditional.
+func (s *Service) SetCollectionFavourites(ctx context.Context, userID, id string, favIDs []string, ifVersion int64) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.SetCollectionFavourites")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	if err := s.checkMembers(ctx, userID, favIDs, "favourite_ids"); err != nil {
+		return nil, err
+	}
+	c, err := s.collections.UpdateCollection(ctx, userID, id, repo.CollectionUpdate{
+		FavouriteIDs: append(make([]string, 0, len(favIDs)), favIDs...),
+		UpdatedAt:    time.Now().UTC(),
+		IfVersion:    ifVersion,
+	})
+	if err != nil {
+		return nil, collectionFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "collection reordered", "collection_id", id, "favourites", len(favIDs))
+	return c, nil
+}
+
+// AddToCollection puts favID into a collection at position (0-based, clamped), or at
+// the end when position is nil. A favourite already in the collection is moved there.
+func (s *Service) AddToCollection(ctx context.Context, userID, id, favID string, position *int, ifVersion int64) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.AddToCollection")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(favID) == "" {
+		return nil, validationError(CodeInvalidCollection, "favourite_id is required", FieldError{"favourite_id", "is required"})
+	}
+	if err := s.checkMembers(ctx, userID, []string{favID}, "favourite_id"); err != nil {
+		return nil, err
+	}
+	return s.editMembers(ctx, userID, id, ifVersion, func(ids []string) ([]string, error) {
+		ids = slices.DeleteFunc(ids, func(m string) bool { return m == favID })
+		if len(ids) >= MaxCollectionSize {
+			return nil, limitExceeded("favourite_id", MaxCollectionSize, "favourites per collection")
+		}
+		at := len(ids)
+		if position != nil {
+			at = min(max(*position, 0), len(ids))
+		}
+		return slices.Insert(ids, at, favID), nil
+	})
+}
+
+// RemoveFromCollection takes favID out of a collection; the favourite itself is kept.
+func (s *Service) RemoveFromCollection(ctx context.Context, userID, id, favID string, ifVersion int64) (_ *models.Collection, err error) {
+	ctx, span := tracer.Start(ctx, "Service.RemoveFromCollection")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	return s.editMembers(ctx, userID, id, ifVersion, func(ids []string) ([]string, error) {
+		i := slices.Index(ids, favID)
+		if i < 0 {
+			return nil, &Error{Kind: ErrNotFound, Code: CodeFavNotFound, Message: "favourite is not in the collection"}
+		}
+		return slices.Delete(ids, i, i+1), nil
+	})
+}
+
+// editMembers applies fn to a copy of a collection's members and stores the result as
+// a compare-and-swap on the version it read. Without ifVersion a lost race is retried,
+// so concurrent edits of different members do not fail each other.
+func (s *Service) editMembers(ctx context.Context, userID, id string, ifVersion int64, fn func([]string) ([]string, error)) (*models.Collection, error) {
+	for attempt := 1; ; attempt++ {
+		cur, err := s.collections.GetCollection(ctx, userID, id)
+		if err != nil {
+			return nil, collectionFromRepo(err)
+		}
+		if ifVersion != 0 && cur.Version != ifVersion {
+			return nil, collectionFromRepo(repo.ErrVersionMismatch)
+		}
+		ids, err := fn(slices.Clone(cur.FavouriteIDs))
+		if err != nil {
+			return nil, err
+		}
+		c, err := s.collections.UpdateCollection(ctx, userID, id, repo.CollectionUpdate{
+			FavouriteIDs: append(make([]string, 0, len(ids)), ids...),
+			UpdatedAt:    time.Now().UTC(),
+			IfVersion:    cur.Version,
+		})
+		if errors.Is(err, repo.ErrVersionMismatch) && ifVersion == 0 && attempt < membershipEditRetries {
+			continue
+		}
+		if err != nil {
+			return nil, collectionFromRepo(err)
+		}
+		s.log.InfoContext(ctx, "collection members changed", "collection_id", id, "favourites", len(c.FavouriteIDs))
+		return c, nil
+	}
+}
+
+// DeleteCollection removes a collection. With cascade its favourites are deleted too,
+// in one atomic batch and from every other collection holding them, before the
+// collection itself goes. A non-zero ifVersion makes the delete conditional.
+//
+// A cascade first empties the collection with a compare-and-swap, which checks ifVersion
+// and settles which favourites go; the collection is then deleted only if nobody changed
+// it since, so a concurrent edit is reported as a version mismatch rather than lost.
+func (s *Service) DeleteCollection(ctx context.Context, userID, id string, ifVersion int64, cascade bool) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteCollection")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return err
+	}
+	deleted := 0
+	if cascade {
+		var members []string
+		emptied, err := s.editMembers(ctx, userID, id, ifVersion, func(ids []string) ([]string, error) {
+			members = ids
+			return []string{}, nil
+		})
+		if err != nil {
+			return err
+		}
+		if deleted, err = s.deleteMembers(ctx, userID, members); err != nil {
+			s.restoreMembers(ctx, userID, emptied, members)
+			return err
+		}
+		ifVersion = emptied.Version
+	}
+	if err := s.collections.DeleteCollection(ctx, userID, id, ifVersion); err != nil {
+		return collectionFromRepo(err)
+	}
+	s.log.InfoContext(ctx, "collection deleted", "collection_id", id, "cascade", cascade, "favourites_deleted", deleted)
+	return nil
+}
+
+// deleteMembers deletes those of favIDs that still exist in one atomic batch, forgets
+// them in every collection and reports how many went.
+func (s *Service) deleteMembers(ctx context.Context, userID string, favIDs []string) (int, error) {
+	if len(favIDs) == 0 {
+		return 0, nil
+	}
+	page, err := s.repo.List(ctx, userID, repo.ListQuery{IDs: favIDs})
+	if err != nil || len(page.Items) == 0 {
+		return 0, fromRepo(err)
+	}
+	ops := make([]repo.Op, len(page.Items))
+	ids := make([]string, len(page.Items))
+	for i, f := range page.Items {
+		ops[i], ids[i] = repo.Op{Kind: repo.OpDelete, FavID: f.ID}, f.ID
+	}
+	if _, err := s.repo.Apply(ctx, userID, ops); err != nil {
+		return 0, fromRepo(err)
+	}
+	s.forget(ctx, userID, ids)
+	return len(ops), nil
+}
+
+// restoreMembers puts back the members of a collection emptied for a cascade that then
+// failed, unless the collection changed meanwhile. It is best effort and only logs.
+func (s *Service) restoreMembers(ctx context.Context, userID string, emptied *models.Collection, favIDs []string) {
+	if len(favIDs) == 0 {
+		return
+	}
+	if _, err := s.collections.UpdateCollection(ctx, userID, emptied.ID, repo.CollectionUpdate{
+		FavouriteIDs: favIDs,
+		UpdatedAt:    time.Now().UTC(),
+		IfVersion:    emptied.Version,
+	}); err != nil {
+		s.log.WarnContext(ctx, "restoring collection members failed", "collection_id", emptied.ID, "favourites", len(favIDs), "err", err)
+	}
+}
+
+// forget drops deleted favourites from the user's collections. The favourites are gone
+// already, so a failure is only logged: a stale member is skipped when listed.
+func (s *Service) forget(ctx context.Context, userID string, favIDs []string) {
+	if len(favIDs) == 0 {
+		return
+	}
+	if err := s.collections.ForgetFavourites(ctx, userID, favIDs, time.Now().UTC()); err != nil {
+		s.log.WarnContext(ctx, "removing deleted favourites from collections failed", "favourites", len(favIDs), "err", err)
+	}
+}
+
+// ListCollectionFavourites returns one page of the favourites in a collection, with the
+// filters of q applied. repo.SortPosition lists them in the collection's manual order;
+// its cursor remembers the position, so paging survives the last item being removed.
+func (s *Service) ListCollectionFavourites(ctx context.Context, userID, id string, q repo.ListQuery) (_ *repo.ListPage, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListCollectionFavourites")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkCollectionPath(userID, id); err != nil {
+		return nil, err
+	}
+	c, err := s.collections.GetCollection(ctx, userID, id)
+	if err != nil {
+		return nil, collectionFromRepo(err)
+	}
+	q.IDs = append(make([]string, 0, len(c.FavouriteIDs)), c.FavouriteIDs...)
+	if q.Sort != repo.SortPosition {
+		return s.listPage(ctx, userID, q)
+	}
+
+	all := q
+	all.Limit, all.Offset, all.After, all.Sort = 0, 0, nil, ""
+	matched, err := s.repo.List(ctx, userID, all)
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	byID := make(map[string]*models.Favourite, len(matched.Items))
+	for _, f := range matched.Items {
+		byID[f.ID] = f
+	}
+	after := -1
+	if q.After != nil {
+		if q.After.Collection != id {
+			return nil, validationError(CodeInvalidCollectionID, "cursor was issued for a different collection",
+				FieldError{"cursor", "belongs to another collection"})
+		}
+		// The cursor's item sat at Position; if it was removed since, its successor moved up.
+		after = q.After.Position - 1
+		if i := slices.Index(c.FavouriteIDs, q.After.ID); i >= 0 {
+			after = i
+		}
+	}
+	var rest []*models.Favourite
+	var positions []int
+	for pos, favID := range c.FavouriteIDs {
+		if f, ok := byID[favID]; ok && pos > after {
+			rest, positions = append(rest, f), append(positions, pos)
+		}
+	}
+	start := 0
+	if q.After == nil {
+		start = min(max(q.Offset, 0), len(rest))
+	}
+	end := len(rest)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(rest))
+	}
+	page := &repo.ListPage{Items: append(make([]*models.Favourite, 0, end-start), rest[start:end]...), Total: len(matched.Items)}
+	if end < len(rest) && end > start {
+		page.Next = &repo.Cursor{Sort: repo.SortPosition, ID: rest[end-1].ID, Position: positions[end-1], Collection: id}
+	}
+	if err := s.resolve(ctx, page.Items); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+)
+
+// Error kinds. Every error the service reports for a bad request is an *Error whose
+// Kind is one of these, so callers can classify it with errors.Is.
+var (
+	ErrValidation         = errors.New("validation failed")
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Stable error codes, one per distinct failure a client may want to handle.
+const (
+	CodeInvalidUserID    = "invalid_user_id"
+	CodeInvalidFavID     = "invalid_favourite_id"
+	CodeInvalidAsset     = "invalid_asset"
+	CodeInvalidBatch     = "invalid_batch"
+	CodeInvalidOperation = "invalid_operation"
+	CodeFavNotFound      = "favourite_not_found"
+	CodeVersionMismatch  = "version_mismatch"
+	CodeAssetTypeChanged = "asset_type_changed"
+	CodeInvalidAssetID   = "invalid_asset_id"
+	CodeAssetNotFound    = "asset_not_found"
+	CodeFavIsReference   = "favourite_is_reference"
+	CodeDuplicateFav     = "duplicate_favourite"
+
+	CodeInvalidCollectionID = "invalid_collection_id"
+	CodeInvalidCollection   = "invalid_collection"
+	CodeCollectionNotFound  = "collection_not_found"
+	CodeLimitExceeded       = "limit_exceeded"
+	CodeInvalidTags         = "invalid_tags"
+)
+
+// FieldError names one invalid field of a request and why it was rejected.
+// Field is a dotted path into the request body, e.g. "asset.title".
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// Error is a classified service error. Kind is one of the Err* sentinels, Code a stable
+// machine-readable identifier, Message a human-readable description and Fields, for
+// validation errors, the individual problems found. ExistingID, for duplicates, is the
+// favourite that already holds the content. Err is the underlying cause, if any.
+type Error struct {
+	Kind       error
+	Code       string
+	Message    string
+	Fields     []FieldError
+	ExistingID string
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Is reports whether target is the error's kind, so errors.Is(err, ErrNotFound) works.
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+// Unwrap returns the cause, so errors.Is also matches e.g. repo.ErrNotFound.
+func (e *Error) Unwrap() error { return e.Err }
+
+// validationError builds an ErrValidation error with the given field problems.
+func validationError(code, msg string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: msg, Fields: fields}
+}
+
+// invalidUserID is returned for a user ID that does not match userIDRe.
+func invalidUserID() error {
+	return validationError(CodeInvalidUserID, "invalid user id",
+		FieldError{"userID", "must be 1-64 letters, digits, '_' or '-'"})
+}
+
+// invalidFavID is returned for an empty favourite ID.
+func invalidFavID() error {
+	return validationError(CodeInvalidFavID, "invalid favourite id", FieldError{"favID", "is required"})
+}
+
+// fromRepo classifies the repository's expected failures; other errors, such as
+// storage failures and cancellations, are returned unchanged.
+func fromRepo(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		return &Error{Kind: ErrNotFound, Code: CodeFavNotFound, Message: "favourite not found", Err: err}
+	case errors.Is(err, repo.ErrVersionMismatch):
+		return &Error{Kind: ErrPreconditionFailed, Code: CodeVersionMismatch, Message: "favourite was modified", Err: err}
+	case errors.Is(err, repo.ErrDuplicate):
+		e := &Error{Kind: ErrConflict, Code: CodeDuplicateFav, Message: "asset is already a favourite", Err: err}
+		var de *repo.DuplicateError
+		if errors.As(err, &de) {
+			e.ExistingID = de.ExistingID
+			e.Message += " (" + de.ExistingID + ")"
+		}
+		return e
+	}
+	return err
+}
+
+// catalogFromRepo is fromRepo for the asset catalog.
+func catalogFromRepo(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		return &Error{Kind: ErrNotFound, Code: CodeAssetNotFound, Message: "asset not found", Err: err}
+	case errors.Is(err, repo.ErrVersionMismatch):
+		return &Error{Kind: ErrPreconditionFailed, Code: CodeVersionMismatch, Message: "asset was modified", Err: err}
+	}
+	return err
+}
+
+// collectionFromRepo is fromRepo for collections.
+func collectionFromRepo(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		return &Error{Kind: ErrNotFound, Code: CodeCollectionNotFound, Message: "collection not found", Err: err}
+	case errors.Is(err, repo.ErrVersionMismatch):
+		return &Error{Kind: ErrPreconditionFailed, Code: CodeVersionMismatch, Message: "collection was modified", Err: err}
+	}
+	return err
+}
+
+// limitExceeded is returned when a write would take a user past one of the per-user limits.
+func limitExceeded(field string, limit int, what string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    CodeLimitExceeded,
+		Message: fmt.Sprintf("limit of %d %s reached", limit, what),
+		Fields:  []FieldError{{field, fmt.Sprintf("must not exceed %d %s", limit, what)}},
+	}
+}
+
+// favIsReference is returned when a full update targets a favourite that references a
+// catalog asset: its payload belongs to the catalog and is changed there.
+func favIsReference(assetID string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    CodeFavIsReference,
+		Message: fmt.Sprintf("favourite references catalog asset %s; update the asset instead", assetID),
+		Fields:  []FieldError{{"asset", "is managed by the asset catalog"}},
+	}
+}
+
+// assetTypeChanged is returned when a replacement asset has a different type than the stored one.
+func assetTypeChanged(from, to string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    CodeAssetTypeChanged,
+		Message: fmt.Sprintf("asset type cannot be changed from %s to %s", from, to),
+		Fields:  []FieldError{{"asset.type", "must be " + from}},
+		Err:     ErrAssetTypeChanged,
+	}
+}
@@ -1,116 +1,619 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/assets"
+	"github.com/KostasDasios/platform-go-challenge/internal/logging"
+	"github.com/KostasDasios/platform-go-challenge/internal/metrics"
 	"github.com/KostasDasios/platform-go-challenge/internal/models"
 	"github.com/KostasDasios/platform-go-challenge/internal/repo"
 )
 
+// ErrAssetTypeChanged is the cause of the ErrConflict returned when a full update tries
+// to turn a favourite into another asset kind.
+var ErrAssetTypeChanged = errors.New("asset type cannot be changed")
+
 type Service struct {
-	repo repo.Repository
+	repo        repo.Repository
+	catalog     repo.AssetRepository
+	collections repo.CollectionRepository
+	types       *assets.Registry
+	metrics     *metrics.Metrics
+	log         *slog.Logger
+	tagLocks    userLocks
+}
+
+// NewService constructs a Service using the provided Repository. Assets are validated
+// with the types in assets.Default; the asset catalog and collections are kept in memory
+// until SetCatalog and SetCollections provide other stores.
+func NewService(r repo.Repository) *Service {
+	return &Service{
+		repo:        r,
+		catalog:     repo.NewInMemoryAssetRepo(),
+		collections: repo.NewInMemoryCollectionRepo(),
+		types:       assets.Default,
+		log:         logging.Discard(),
+	}
 }
 
-// NewService constructs a Service using the provided Repository.
-func NewService(repo repo.Repository) *Service { return &Service{repo: repo} }
+// SetAssetTypes makes the service accept the asset types in r instead of assets.Default.
+func (s *Service) SetAssetTypes(r *assets.Registry) { s.types = r }
+
+// AssetTypes returns the registry of asset types the service accepts.
+func (s *Service) AssetTypes() *assets.Registry { return s.types }
+
+// SetMetrics makes the service record validation failures in m, which should be built
+// with the registry of AssetTypes so that the service's types get their own labels.
+func (s *Service) SetMetrics(m *metrics.Metrics) { s.metrics = m }
+
+// SetLogger makes the service log its events (writes, rejected assets, aborted batches) to l.
+func (s *Service) SetLogger(l *slog.Logger) { s.log = l }
+
+var tracer = otel.Tracer("github.com/KostasDasios/platform-go-challenge/internal/service")
+
+// endSpan records err, if any, on the span of a service method and ends it. Errors are
+// not marked as span failures here: most are client errors, and the HTTP and repository
+// spans already report server-side failures.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
 
 var userIDRe = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,64}$`)
 
 func (s *Service) ValidateUserID(id string) bool { return userIDRe.MatchString(id) }
 
-// ListFavourites returns all favourites for a user after validating the identifier.
-func (s *Service) ListFavourites(userID string) ([]*models.Favourite, error) {
+// checkPath validates the user and favourite IDs addressing a single favourite.
+func (s *Service) checkPath(userID, favID string) error {
 	if !s.ValidateUserID(userID) {
-		return nil, fmt.Errorf("invalid user id")
+		return invalidUserID()
 	}
-	return s.repo.List(userID)
+	if strings.TrimSpace(favID) == "" {
+		return invalidFavID()
+	}
+	return nil
 }
 
-// CreateFavourite validates the raw asset payload, normalises metadata and persists a new favourite.
-func (s *Service) CreateFavourite(userID string, raw json.RawMessage) (*models.Favourite, error) {
+// ListFavourites returns one page of a user's favourites after validating the identifier.
+// The manual order repo.SortPosition only exists within a collection (see ListCollectionFavourites).
+func (s *Service) ListFavourites(ctx context.Context, userID string, q repo.ListQuery) (_ *repo.ListPage, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListFavourites")
+	defer func() { endSpan(span, err) }()
 	if !s.ValidateUserID(userID) {
-		return nil, fmt.Errorf("invalid user id")
+		return nil, invalidUserID()
+	}
+	if q.Sort == repo.SortPosition {
+		return nil, validationError(CodeInvalidCollectionID, "sorting by position needs a collection",
+			FieldError{"collection", "is required to sort by position"})
 	}
-	t, desc, err := validateAsset(raw)
+	return s.listPage(ctx, userID, q)
+}
+
+// listPage fetches one page from the repository and resolves its catalog references.
+func (s *Service) listPage(ctx context.Context, userID string, q repo.ListQuery) (*repo.ListPage, error) {
+	page, err := s.repo.List(ctx, userID, q)
 	if err != nil {
+		return nil, fromRepo(err)
+	}
+	if err := s.resolve(ctx, page.Items); err != nil {
 		return nil, err
 	}
-	f := &models.Favourite{
+	return page, nil
+}
+
+// GetFavourite returns a single favourite by id.
+func (s *Service) GetFavourite(ctx context.Context, userID, favID string) (_ *models.Favourite, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetFavourite")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPath(userID, favID); err != nil {
+		return nil, err
+	}
+	f, err := s.repo.Get(ctx, userID, favID)
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	return s.resolveOne(ctx, f)
+}
+
+// CreateFavourite validates the raw asset payload, normalises metadata and tags and persists
+// a new favourite. Saving an asset the user already has fails with ErrConflict naming the
+// existing favourite, unless allowDuplicates is set (e.g. for legacy imports); such a
+// favourite is then exempt from the check for good.
+func (s *Service) CreateFavourite(ctx context.Context, userID string, raw json.RawMessage, tags []string, allowDuplicates bool) (_ *models.Favourite, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateFavourite")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	f, err := s.newFavourite(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.create(ctx, userID, f, tags, allowDuplicates)
+}
+
+// CreateFavouriteRef persists a new favourite that references the catalog asset assetID
+// instead of embedding a copy. A nil description takes the asset's. Tags and duplicates
+// are handled as in CreateFavourite.
+func (s *Service) CreateFavouriteRef(ctx context.Context, userID, assetID string, description *string, tags []string, allowDuplicates bool) (_ *models.Favourite, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateFavouriteRef")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	f, err := s.newReference(ctx, assetID, description)
+	if err != nil {
+		return nil, err
+	}
+	return s.create(ctx, userID, f, tags, allowDuplicates)
+}
+
+// create tags and stores a new favourite and returns it with its asset resolved. With
+// allowDuplicates the favourite is stored without a content hash.
+func (s *Service) create(ctx context.Context, userID string, f *models.Favourite, tags []string, allowDuplicates bool) (_ *models.Favourite, err error) {
+	defer s.tagLocks.lockTags(userID, tags)()
+	if f.Tags, err = s.checkTags(ctx, userID, tags, nil); err != nil {
+		return nil, err
+	}
+	if len(f.Tags) == 0 {
+		f.Tags = nil
+	}
+	if allowDuplicates {
+		f.ContentHash = ""
+	}
+	if err := s.repo.Create(ctx, userID, f); err != nil {
+		return nil, fromRepo(err)
+	}
+	s.log.InfoContext(ctx, "favourite created", "fav_id", f.ID, "type", f.Type, "asset_id", f.AssetID)
+	return s.resolveOne(ctx, f)
+}
+
+// newFavourite validates a raw asset payload and builds a favourite for it, ready to be stored.
+func (s *Service) newFavourite(ctx context.Context, raw json.RawMessage) (*models.Favourite, error) {
+	info, err := s.validate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Favourite{
 		ID:          newID(),
-		Type:        t,
-		Description: desc,
+		Type:        info.Type,
+		Description: info.Description,
 		Asset:       raw,
 		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+		SearchText:  info.SearchText,
+		ContentHash: repo.ContentHash(raw),
+	}, nil
+}
+
+// UpdateFavourite updates the user-editable metadata of a favourite: its description
+// and/or its tags, which replace the current ones (an empty list removes them all). Nil
+// arguments are left unchanged. A non-zero ifVersion makes the update conditional
+// (repo.ErrVersionMismatch on conflict).
+func (s *Service) UpdateFavourite(ctx context.Context, userID, favID string, desc *string, tags []string, ifVersion int64) (_ *models.Favourite, err error) {
+	ctx, span := tracer.Start(ctx, "Service.UpdateFavourite")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPath(userID, favID); err != nil {
+		return nil, err
+	}
+	defer s.tagLocks.lockTags(userID, tags)()
+	if tags != nil {
+		cur, err := s.repo.Get(ctx, userID, favID)
+		if err != nil {
+			return nil, fromRepo(err)
+		}
+		if tags, err = s.checkTags(ctx, userID, tags, cur.Tags); err != nil {
+			return nil, err
+		}
+	}
+	f, err := s.repo.Update(ctx, userID, favID, repo.Update{Description: desc, Tags: tags, UpdatedAt: time.Now().UTC(), IfVersion: ifVersion})
+	if err != nil {
+		return nil, fromRepo(err)
 	}
-	if err := s.repo.Create(userID, f); err != nil {
+	s.log.InfoContext(ctx, "favourite updated", "fav_id", favID, "version", f.Version)
+	return s.resolveOne(ctx, f)
+}
+
+// ReplaceFavourite re-validates a full asset payload and replaces the stored one.
+// ID and CreatedAt are preserved; the asset type must match the existing favourite.
+// Favourites referencing a catalog asset cannot be replaced; the asset is updated instead.
+// The content hash is recomputed, so replacing with an asset the user already has is an
+// ErrConflict. A non-zero ifVersion makes the replacement conditional.
+func (s *Service) ReplaceFavourite(ctx context.Context, userID, favID string, raw json.RawMessage, ifVersion int64) (_ *models.Favourite, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ReplaceFavourite")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPath(userID, favID); err != nil {
 		return nil, err
 	}
+	info, err := s.validate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.repo.Get(ctx, userID, favID)
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	if ifVersion != 0 && cur.Version != ifVersion {
+		return nil, fromRepo(repo.ErrVersionMismatch)
+	}
+	if cur.AssetID != "" {
+		return nil, favIsReference(cur.AssetID)
+	}
+	if cur.Type != info.Type {
+		return nil, assetTypeChanged(string(cur.Type), string(info.Type))
+	}
+	hash := repo.ContentHash(raw)
+	f, err := s.repo.Update(ctx, userID, favID, repo.Update{
+		Description: &info.Description,
+		Asset:       raw,
+		SearchText:  &info.SearchText,
+		ContentHash: &hash,
+		UpdatedAt:   time.Now().UTC(),
+		IfVersion:   ifVersion,
+	})
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	s.log.InfoContext(ctx, "favourite replaced", "fav_id", favID, "version", f.Version)
 	return f, nil
 }
 
-// UpdateFavouriteDescription updates only the editable description field for a favourite.
-func (s *Service) UpdateFavouriteDescription(userID, favID, desc string) (*models.Favourite, error) {
-	if !s.ValidateUserID(userID) || strings.TrimSpace(favID) == "" {
-		return nil, fmt.Errorf("invalid path")
+// DeleteFavourite removes a favourite by id; a non-zero ifVersion makes the delete conditional.
+func (s *Service) DeleteFavourite(ctx context.Context, userID, favID string, ifVersion int64) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteFavourite")
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPath(userID, favID); err != nil {
+		return err
 	}
-	return s.repo.UpdateDescription(userID, favID, desc)
+	if err := s.repo.Delete(ctx, userID, favID, ifVersion); err != nil {
+		return fromRepo(err)
+	}
+	s.forget(ctx, userID, []string{favID})
+	s.log.InfoContext(ctx, "favourite deleted", "fav_id", favID)
+	return nil
 }
 
-// DeleteFavourite removes a favourite by id.
-func (s *Service) DeleteFavourite(userID, favID string) error {
-	if !s.ValidateUserID(userID) || strings.TrimSpace(favID) == "" {
-		return fmt.Errorf("invalid path")
+// MaxBatchSize caps the number of operations accepted in one batch request.
+const MaxBatchSize = 1000
+
+// ErrBatchAborted is reported for operations of an atomic batch that were not applied
+// because another operation in it failed.
+var ErrBatchAborted = errors.New("not applied: atomic batch aborted")
+
+// Batch operation kinds accepted by ApplyBatch.
+const (
+	BatchCreate = "create"
+	BatchPatch  = "patch"
+	BatchDelete = "delete"
+)
+
+// BatchOp is one item of a batch: a create (Asset, or AssetID and an optional
+// Description, and optional Tags), a patch (ID and Description and/or Tags, as in
+// UpdateFavourite) or a delete (ID). A non-zero IfVersion makes it conditional;
+// AllowDuplicates exempts a create from the duplicate check as in CreateFavourite.
+type BatchOp struct {
+	Op              string
+	ID              string
+	Asset           json.RawMessage
+	AssetID         string
+	Description     *string
+	Tags            []string
+	IfVersion       int64
+	AllowDuplicates bool
+}
+
+// BatchResult is the outcome of one BatchOp. Favourite is nil for deletes and failures.
+type BatchResult struct {
+	Favourite *models.Favourite
+	Err       error
+}
+
+// ApplyBatch validates and applies ops in order and returns one result per op.
+// Without atomic every op succeeds or fails on its own. With atomic the batch is
+// applied all-or-nothing: if any op fails, its result carries the cause, the others
+// carry ErrBatchAborted and ErrBatchAborted is returned.
+func (s *Service) ApplyBatch(ctx context.Context, userID string, ops []BatchOp, atomic bool) (_ []BatchResult, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ApplyBatch")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	if len(ops) == 0 || len(ops) > MaxBatchSize {
+		return nil, validationError(CodeInvalidBatch, "invalid batch",
+			FieldError{"operations", fmt.Sprintf("must contain between 1 and %d operations", MaxBatchSize)})
+	}
+	// Tags added by earlier operations count towards the limit for later ones. Deletes
+	// in the batch do not make room for them.
+	var budget *tagBudget
+	if i := slices.IndexFunc(ops, func(op BatchOp) bool { return len(op.Tags) > 0 }); i >= 0 {
+		defer s.tagLocks.lockTags(userID, ops[i].Tags)()
+		if budget, err = s.tagBudget(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]BatchResult, len(ops))
+	prepared := make([]repo.Op, len(ops))
+
+	if !atomic {
+		// Each operation is applied before the next is prepared, so it sees the state
+		// the previous ones left behind.
+		for i, op := range ops {
+			prepared[i], results[i].Err = s.prepareOp(ctx, userID, op, budget)
+			if results[i].Err == nil {
+				results[i].Favourite, results[i].Err = s.applyOp(ctx, userID, prepared[i])
+			}
+			if results[i].Err != nil && budget != nil {
+				// The budget took tags that were not stored; start again from the repository.
+				if budget, err = s.tagBudget(ctx, userID); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := s.resolveResults(ctx, results); err != nil {
+			return nil, err
+		}
+		s.forgetDeleted(ctx, userID, prepared, results)
+		failures := 0
+		for _, res := range results {
+			if res.Err != nil {
+				failures++
+			}
+		}
+		s.log.InfoContext(ctx, "batch applied", "ops", len(ops), "failed", failures, "atomic", false)
+		return results, nil
+	}
+
+	failed := -1
+	for i, op := range ops {
+		prepared[i], results[i].Err = s.prepareOp(ctx, userID, op, budget)
+		if results[i].Err != nil && failed < 0 {
+			failed = i
+		}
+	}
+	if failed < 0 {
+		out, err := s.repo.Apply(ctx, userID, prepared)
+		var be *repo.BatchError
+		switch {
+		case err == nil:
+			for i := range results {
+				results[i].Favourite = out[i]
+			}
+			if err := s.resolveResults(ctx, results); err != nil {
+				return nil, err
+			}
+			s.forgetDeleted(ctx, userID, prepared, results)
+			s.log.InfoContext(ctx, "batch applied", "ops", len(ops), "failed", 0, "atomic", true)
+			return results, nil
+		case errors.As(err, &be):
+			failed, results[be.Index].Err = be.Index, fromRepo(be.Err)
+		default:
+			return nil, err
+		}
+	}
+	for i := range results {
+		if i != failed {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
 	}
-	return s.repo.Delete(userID, favID)
+	s.log.WarnContext(ctx, "atomic batch aborted", "ops", len(ops), "index", failed, "err", results[failed].Err)
+	return results, ErrBatchAborted
 }
 
-// validateAsset performs a two-step decode: probe for type, then validate concrete schema.
-// This keeps the service flexible for additional asset types without changing the transport contract.
-func validateAsset(raw json.RawMessage) (models.AssetType, string, error) {
-	var probe struct {
-		Type        models.AssetType `json:"type"`
-		Description string    `json:"description"`
+// resolveResults resolves the catalog assets of the favourites in results.
+func (s *Service) resolveResults(ctx context.Context, results []BatchResult) error {
+	favs := make([]*models.Favourite, len(results))
+	for i, res := range results {
+		favs[i] = res.Favourite
 	}
-	if err := json.Unmarshal(raw, &probe); err != nil {
-		return "", "", fmt.Errorf("invalid asset json: %w", err)
+	if err := s.resolve(ctx, favs); err != nil {
+		return err
+	}
+	for i := range results {
+		results[i].Favourite = favs[i]
+	}
+	return nil
+}
+
+// forgetDeleted drops the favourites deleted by a batch from the user's collections.
+func (s *Service) forgetDeleted(ctx context.Context, userID string, ops []repo.Op, results []BatchResult) {
+	var ids []string
+	for i, op := range ops {
+		if op.Kind == repo.OpDelete && results[i].Err == nil {
+			ids = append(ids, op.FavID)
+		}
 	}
-	switch probe.Type {
-	case models.AssetChart:
-		var c models.Chart
-		if err := json.Unmarshal(raw, &c); err != nil {
-			return "", "", fmt.Errorf("invalid chart: %w", err)
+	s.forget(ctx, userID, ids)
+}
+
+// prepareOp validates a batch item and turns it into a repository operation. Field
+// paths in its validation errors are relative to the operation. budget is only used,
+// and so only needed, by operations setting tags.
+func (s *Service) prepareOp(ctx context.Context, userID string, op BatchOp, budget *tagBudget) (repo.Op, error) {
+	switch op.Op {
+	case BatchCreate:
+		var (
+			f   *models.Favourite
+			err error
+		)
+		switch {
+		case op.AssetID != "" && op.Asset != nil:
+			err = validationError(CodeInvalidOperation, "create needs either asset or asset_id",
+				FieldError{"asset_id", "must not be set together with asset"})
+		case op.AssetID != "":
+			f, err = s.newReference(ctx, op.AssetID, op.Description)
+		default:
+			f, err = s.newFavourite(ctx, op.Asset)
+		}
+		if err != nil {
+			return repo.Op{}, err
+		}
+		if op.AllowDuplicates {
+			f.ContentHash = ""
+		}
+		if f.Tags, err = budget.admit(f.ID, op.Tags, nil); err != nil {
+			return repo.Op{}, err
+		}
+		if len(f.Tags) == 0 {
+			f.Tags = nil
 		}
-		if strings.TrimSpace(c.Title) == "" || len(c.Data) == 0 {
-			return "", "", errors.New("chart needs title and non-empty data")
+		return repo.Op{Kind: repo.OpCreate, Fav: f}, nil
+	case BatchPatch:
+		var fields []FieldError
+		if strings.TrimSpace(op.ID) == "" {
+			fields = append(fields, FieldError{"id", "is required"})
 		}
-		return models.AssetChart, c.Description, nil
-	case models.AssetInsight:
-		var in models.Insight
-		if err := json.Unmarshal(raw, &in); err != nil {
-			return "", "", fmt.Errorf("invalid insight: %w", err)
+		if op.Description == nil && op.Tags == nil {
+			fields = append(fields, FieldError{"description", "is required unless tags are set"})
 		}
-		if strings.TrimSpace(in.Text) == "" {
-			return "", "", errors.New("insight needs text")
+		if fields != nil {
+			return repo.Op{}, validationError(CodeInvalidOperation, "patch needs id and description or tags", fields...)
 		}
-		return models.AssetInsight, in.Description, nil
-	case models.AssetAudience:
-		var a models.Audience
-		if err := json.Unmarshal(raw, &a); err != nil {
-			return "", "", fmt.Errorf("invalid audience: %w", err)
+		// Like UpdateFavourite, read the tags being replaced so that those the favourite
+		// drops make room for new ones.
+		var stored []string
+		if len(op.Tags) > 0 {
+			cur, err := s.repo.Get(ctx, userID, op.ID)
+			if err != nil {
+				return repo.Op{}, fromRepo(err)
+			}
+			stored = cur.Tags
 		}
-		if a.Gender == "" || len(a.AgeGroups) == 0 {
-			return "", "", errors.New("audience needs gender and age_groups")
+		tags, err := budget.admit(op.ID, op.Tags, stored)
+		if err != nil {
+			return repo.Op{}, err
 		}
-		return models.AssetAudience, a.Description, nil
+		return repo.Op{Kind: repo.OpUpdate, FavID: op.ID, Update: repo.Update{
+			Description: op.Description, Tags: tags, UpdatedAt: time.Now().UTC(), IfVersion: op.IfVersion,
+		}}, nil
+	case BatchDelete:
+		if strings.TrimSpace(op.ID) == "" {
+			return repo.Op{}, validationError(CodeInvalidOperation, "delete needs id", FieldError{"id", "is required"})
+		}
+		return repo.Op{Kind: repo.OpDelete, FavID: op.ID, IfVersion: op.IfVersion}, nil
 	default:
-		return "", "", errors.New("unknown asset type")
+		return repo.Op{}, validationError(CodeInvalidOperation, fmt.Sprintf("unknown op %q", op.Op),
+			FieldError{"op", "must be create, patch or delete"})
+	}
+}
+
+// applyOp runs a single prepared operation outside of a batch transaction.
+func (s *Service) applyOp(ctx context.Context, userID string, op repo.Op) (*models.Favourite, error) {
+	switch op.Kind {
+	case repo.OpCreate:
+		if err := s.repo.Create(ctx, userID, op.Fav); err != nil {
+			return nil, fromRepo(err)
+		}
+		return op.Fav, nil
+	case repo.OpUpdate:
+		f, err := s.repo.Update(ctx, userID, op.FavID, op.Update)
+		return f, fromRepo(err)
+	default:
+		return nil, fromRepo(s.repo.Delete(ctx, userID, op.FavID, op.IfVersion))
+	}
+}
+
+// assetInfo is the metadata the service derives from a validated asset payload.
+type assetInfo struct {
+	Type        models.AssetType
+	Description string
+	SearchText  string // lower-cased title/text matched by list search
+}
+
+// validate runs validateAsset and counts failures by the type the payload declares.
+func (s *Service) validate(ctx context.Context, raw json.RawMessage) (_ assetInfo, err error) {
+	ctx, span := tracer.Start(ctx, "Service.validate")
+	defer func() { endSpan(span, err) }()
+	info, err := validateAsset(s.types, raw)
+	if err != nil {
+		var probe struct {
+			Type models.AssetType `json:"type"`
+		}
+		_ = json.Unmarshal(raw, &probe)
+		s.metrics.ValidationFailed(probe.Type)
+		s.log.DebugContext(ctx, "asset rejected", "type", probe.Type, "err", err)
+	}
+	return info, err
+}
+
+// validateAsset performs a two-step decode: probe for type, then validate the payload
+// with the asset type registered under it: its schema, its decoder and, if any, its
+// own validation rules. A rejected asset yields an ErrValidation error listing every
+// violation found, not just the first.
+func validateAsset(types *assets.Registry, raw json.RawMessage) (assetInfo, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return assetInfo{}, invalidAsset("asset is required", FieldError{"asset", "is required"})
+	}
+	var probe struct {
+		Type        json.RawMessage `json:"type"`
+		Description string          `json:"description"`
 	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		// a mistyped description is reported by the type's schema below
+		var te *json.UnmarshalTypeError
+		if !errors.As(err, &te) {
+			return assetInfo{}, invalidAsset("invalid asset json", FieldError{"asset", "must be a JSON object"})
+		}
+	}
+	if probe.Type == nil {
+		return assetInfo{}, invalidAsset("asset type is required", FieldError{"asset.type", "is required"})
+	}
+	var name models.AssetType
+	_ = json.Unmarshal(probe.Type, &name)
+	t, ok := types.Lookup(name)
+	if !ok {
+		var names []string
+		for _, n := range types.Names() {
+			names = append(names, string(n))
+		}
+		return assetInfo{}, invalidAsset("unknown asset type", FieldError{"asset.type", "must be one of " + strings.Join(names, ", ")})
+	}
+
+	violations, err := t.Schema.Validate(raw)
+	if err != nil {
+		return assetInfo{}, err
+	}
+	var v any
+	if len(violations) == 0 {
+		if v, err = t.Decode(raw); err != nil {
+			return assetInfo{}, invalidAsset("invalid "+string(name), FieldError{"asset", err.Error()})
+		}
+		if t.Validate != nil {
+			violations = t.Validate(v)
+		}
+	}
+	if len(violations) > 0 {
+		fields := make([]FieldError, len(violations))
+		for i, v := range violations {
+			fields[i] = FieldError{strings.TrimSuffix("asset."+v.Field, "."), v.Reason}
+		}
+		return assetInfo{}, invalidAsset("invalid "+string(name), fields...)
+	}
+
+	info := assetInfo{Type: name, Description: probe.Description}
+	if t.SearchText != nil {
+		info.SearchText = strings.ToLower(t.SearchText(v))
+	}
+	return info, nil
+}
+
+// invalidAsset builds the validation error for a rejected asset payload.
+func invalidAsset(msg string, fields ...FieldError) error {
+	return validationError(CodeInvalidAsset, msg, fields...)
 }
 
 // newID generates a short random identifier.
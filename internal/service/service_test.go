@@ -1,11 +1,19 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
 	"testing"
 
-	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+	"github.com/KostasDasios/platform-go-challenge/internal/assets"
 	"github.com/KostasDasios/platform-go-challenge/internal/models"
+	"github.com/KostasDasios/platform-go-challenge/internal/repo"
+	"github.com/KostasDasios/platform-go-challenge/internal/schema"
 )
 
 func mustRaw(v any) json.RawMessage {
@@ -14,8 +22,8 @@ func mustRaw(v any) json.RawMessage {
 }
 
 func TestService_CreateListUpdateDelete(t *testing.T) {
-	repo := repo.NewInMemoryRepo()
-	svc := NewService(repo)
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
 
 	user := "kostas"
 
@@ -24,7 +32,7 @@ func TestService_CreateListUpdateDelete(t *testing.T) {
 		AssetBase: models.AssetBase{Type: models.AssetInsight, Description: "baseline"},
 		Text:      "40% of users…",
 	}
-	f1, err := svc.CreateFavourite(user, mustRaw(insight))
+	f1, err := svc.CreateFavourite(ctx, user, mustRaw(insight), nil, false)
 	if err != nil {
 		t.Fatalf("create insight: %v", err)
 	}
@@ -40,22 +48,23 @@ func TestService_CreateListUpdateDelete(t *testing.T) {
 		AxisYTitle: "€",
 		Data:       []float64{1, 2, 3},
 	}
-	_, err = svc.CreateFavourite(user, mustRaw(chart))
+	_, err = svc.CreateFavourite(ctx, user, mustRaw(chart), nil, false)
 	if err != nil {
 		t.Fatalf("create chart: %v", err)
 	}
 
 	// list
-	list, err := svc.ListFavourites(user)
+	page, err := svc.ListFavourites(ctx, user, repo.ListQuery{})
 	if err != nil {
 		t.Fatalf("list: %v", err)
 	}
-	if len(list) != 2 {
-		t.Fatalf("expected 2 favourites, got %d", len(list))
+	if len(page.Items) != 2 {
+		t.Fatalf("expected 2 favourites, got %d", len(page.Items))
 	}
 
 	// update description
-	upd, err := svc.UpdateFavouriteDescription(user, f1.ID, "updated")
+	desc := "updated"
+	upd, err := svc.UpdateFavourite(ctx, user, f1.ID, &desc, nil, 0)
 	if err != nil {
 		t.Fatalf("update desc: %v", err)
 	}
@@ -64,21 +73,21 @@ func TestService_CreateListUpdateDelete(t *testing.T) {
 	}
 
 	// delete
-	if err := svc.DeleteFavourite(user, f1.ID); err != nil {
+	if err := svc.DeleteFavourite(ctx, user, f1.ID, 0); err != nil {
 		t.Fatalf("delete: %v", err)
 	}
-	list, _ = svc.ListFavourites(user)
-	if len(list) != 1 {
-		t.Fatalf("expected 1 favourite after delete, got %d", len(list))
+	page, _ = svc.ListFavourites(ctx, user, repo.ListQuery{})
+	if len(page.Items) != 1 {
+		t.Fatalf("expected 1 favourite after delete, got %d", len(page.Items))
 	}
 }
 
 func TestService_ValidationErrors(t *testing.T) {
-	repo := repo.NewInMemoryRepo()
-	svc := NewService(repo)
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
 
 	// invalid user
-	if _, err := svc.ListFavourites("!!!"); err == nil {
+	if _, err := svc.ListFavourites(ctx, "!!!", repo.ListQuery{}); err == nil {
 		t.Fatalf("expected invalid user id")
 	}
 
@@ -86,7 +95,7 @@ func TestService_ValidationErrors(t *testing.T) {
 	raw := mustRaw(struct {
 		Type string `json:"type"`
 	}{Type: "unknown"})
-	if _, err := svc.CreateFavourite("ok_user", raw); err == nil {
+	if _, err := svc.CreateFavourite(ctx, "ok_user", raw, nil, false); err == nil {
 		t.Fatalf("expected error for unknown asset type")
 	}
 
@@ -94,7 +103,473 @@ func TestService_ValidationErrors(t *testing.T) {
 	badChart := models.Chart{
 		AssetBase: models.AssetBase{Type: models.AssetChart},
 	}
-	if _, err := svc.CreateFavourite("ok_user", mustRaw(badChart)); err == nil {
-		t.Fatalf("expected chart validation error")
+	_, err := svc.CreateFavourite(ctx, "ok_user", mustRaw(badChart), nil, false)
+	var se *Error
+	if !errors.As(err, &se) || !errors.Is(err, ErrValidation) || se.Code != CodeInvalidAsset {
+		t.Fatalf("expected chart validation error, got %v", err)
+	}
+	want := []FieldError{{"asset.data", "must be an array"}, {"asset.title", "must not be blank"}}
+	if !reflect.DeepEqual(se.Fields, want) {
+		t.Fatalf("fields = %+v, want %+v", se.Fields, want)
+	}
+
+	// repository outcomes are classified
+	if _, err := svc.GetFavourite(ctx, "ok_user", "missing"); !errors.Is(err, ErrNotFound) || !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestService_HonoursCancelledContext(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	insight := models.Insight{AssetBase: models.AssetBase{Type: models.AssetInsight}, Text: "t"}
+	if _, err := svc.CreateFavourite(ctx, "kostas", mustRaw(insight), nil, false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("create with cancelled ctx: want context.Canceled, got %v", err)
+	}
+	if _, err := svc.ListFavourites(ctx, "kostas", repo.ListQuery{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list with cancelled ctx: want context.Canceled, got %v", err)
+	}
+}
+
+func TestService_ReplaceFavourite(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	chart := models.Chart{AssetBase: models.AssetBase{Type: models.AssetChart, Description: "v1"}, Title: "Sales", Data: []float64{1}}
+	f, err := svc.CreateFavourite(ctx, "kostas", mustRaw(chart), nil, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	chart.Description, chart.Data = "v2", []float64{1, 2, 3}
+	upd, err := svc.ReplaceFavourite(ctx, "kostas", f.ID, mustRaw(chart), 0)
+	if err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if upd.ID != f.ID || !upd.CreatedAt.Equal(f.CreatedAt) || upd.UpdatedAt == nil || upd.Description != "v2" {
+		t.Fatalf("unexpected replaced favourite: %+v", upd)
+	}
+
+	// re-validation still applies
+	chart.Data = nil
+	if _, err := svc.ReplaceFavourite(ctx, "kostas", f.ID, mustRaw(chart), 0); err == nil {
+		t.Fatalf("expected validation error for chart without data")
+	}
+
+	// switching asset kind is forbidden
+	insight := models.Insight{AssetBase: models.AssetBase{Type: models.AssetInsight}, Text: "t"}
+	if _, err := svc.ReplaceFavourite(ctx, "kostas", f.ID, mustRaw(insight), 0); !errors.Is(err, ErrAssetTypeChanged) {
+		t.Fatalf("want ErrAssetTypeChanged, got %v", err)
+	}
+	if _, err := svc.ReplaceFavourite(ctx, "kostas", "missing", mustRaw(insight), 0); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+// TestService_CustomAssetType checks that a type added to the registry is validated,
+// stored and searchable without any change to the service.
+func TestService_CustomAssetType(t *testing.T) {
+	type dashboard struct {
+		Name    string   `json:"name"`
+		Widgets []string `json:"widgets"`
+	}
+	types := assets.NewRegistry()
+	types.MustRegister(assets.Of("dashboard", schema.MustCompile([]byte(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}, "widgets": {"type": "array", "items": {"type": "string"}}},
+		"required": ["name", "widgets"]
+	}`)), func(d dashboard) []schema.Violation {
+		if len(d.Widgets) > 2 {
+			return []schema.Violation{{Field: "widgets", Reason: "must have at most 2 items"}}
+		}
+		return nil
+	}, func(d dashboard) string { return d.Name }))
+	svc := NewService(repo.NewInMemoryRepo())
+	svc.SetAssetTypes(types)
+	ctx := context.Background()
+
+	f, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"dashboard","name":"KPIs","widgets":["a"],"description":"d"}`), nil, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if f.Type != "dashboard" || f.Description != "d" || f.SearchText != "kpis" {
+		t.Fatalf("unexpected favourite: %+v", f)
+	}
+
+	var se *Error
+	_, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"dashboard","name":"KPIs","widgets":["a","b","c"]}`), nil, false)
+	if !errors.As(err, &se) || len(se.Fields) != 1 || se.Fields[0].Field != "asset.widgets" {
+		t.Fatalf("want widgets violation, got %v", err)
+	}
+	_, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"chart","title":"t","data":[1]}`), nil, false)
+	if !errors.As(err, &se) || se.Fields[0] != (FieldError{"asset.type", "must be one of dashboard"}) {
+		t.Fatalf("want unknown type, got %v", err)
+	}
+}
+
+func TestService_ApplyBatch(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	insight := mustRaw(models.Insight{AssetBase: models.AssetBase{Type: models.AssetInsight}, Text: "t"})
+	desc := "renamed"
+	ops := []BatchOp{
+		{Op: BatchCreate, Asset: insight},
+		{Op: BatchCreate, Asset: mustRaw(map[string]string{"type": "video"})},
+		{Op: BatchPatch, ID: "missing", Description: &desc},
+	}
+
+	// independent mode: the valid create goes through, the others fail on their own
+	res, err := svc.ApplyBatch(ctx, "kostas", ops, false)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if res[0].Err != nil || res[0].Favourite == nil || res[1].Err == nil || !errors.Is(res[2].Err, repo.ErrNotFound) {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+
+	// atomic mode: the invalid asset aborts everything
+	res, err = svc.ApplyBatch(ctx, "kostas", ops, true)
+	if !errors.Is(err, ErrBatchAborted) {
+		t.Fatalf("want ErrBatchAborted, got %v", err)
+	}
+	if !errors.Is(res[0].Err, ErrBatchAborted) || res[1].Err == nil || errors.Is(res[1].Err, ErrBatchAborted) {
+		t.Fatalf("unexpected atomic results: %+v", res)
+	}
+
+	// atomic mode: a repository-level failure is attributed to its operation
+	other := mustRaw(models.Insight{AssetBase: models.AssetBase{Type: models.AssetInsight}, Text: "u"})
+	res, err = svc.ApplyBatch(ctx, "kostas", []BatchOp{{Op: BatchCreate, Asset: other}, ops[2]}, true)
+	if !errors.Is(err, ErrBatchAborted) || !errors.Is(res[1].Err, repo.ErrNotFound) || !errors.Is(res[0].Err, ErrBatchAborted) {
+		t.Fatalf("unexpected atomic results: %+v %v", res, err)
+	}
+	if page, _ := svc.ListFavourites(ctx, "kostas", repo.ListQuery{}); page.Total != 1 {
+		t.Fatalf("aborted batches must not write, have %d favourites", page.Total)
+	}
+
+	if _, err := svc.ApplyBatch(ctx, "kostas", nil, false); err == nil {
+		t.Fatalf("expected error for an empty batch")
+	}
+}
+
+// TestService_AssetReferences checks that favourites created from the catalog, alone or
+// in a batch, are resolved on read and never write back into the catalog.
+func TestService_AssetReferences(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	a, err := svc.CreateAsset(ctx, json.RawMessage(`{"type":"chart","title":"Revenue","data":[1,2]}`))
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	res, err := svc.ApplyBatch(ctx, "kostas", []BatchOp{
+		{Op: BatchCreate, AssetID: a.ID},
+		{Op: BatchCreate, AssetID: a.ID, Asset: json.RawMessage(`{"type":"insight","text":"t"}`)},
+		{Op: BatchCreate, AssetID: "missing"},
+	}, false)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if f := res[0].Favourite; f == nil || f.AssetID != a.ID || f.Type != models.AssetChart || string(f.Asset) != string(a.Data) || f.AssetVersion != 1 {
+		t.Fatalf("batch reference = %+v", res[0])
+	}
+	for _, i := range []int{1, 2} {
+		var se *Error
+		if !errors.As(res[i].Err, &se) || !errors.Is(se, ErrValidation) {
+			t.Fatalf("op %d: want validation error, got %v", i, res[i].Err)
+		}
+	}
+
+	if _, err := svc.ReplaceAsset(ctx, a.ID, json.RawMessage(`{"type":"chart","title":"Costs","data":[3]}`), 1); err != nil {
+		t.Fatalf("ReplaceAsset: %v", err)
+	}
+	page, err := svc.ListFavourites(ctx, "kostas", repo.ListQuery{Search: "costs"})
+	if err != nil || page.Total != 1 || page.Items[0].AssetVersion != 2 || string(page.Items[0].Asset) != `{"type":"chart","title":"Costs","data":[3]}` {
+		t.Fatalf("list after asset update = %+v, %v", page, err)
+	}
+	if old, err := svc.ListFavourites(ctx, "kostas", repo.ListQuery{Search: "revenue"}); err != nil || old.Total != 0 {
+		t.Fatalf("search for the old title = %+v, %v", old, err)
+	}
+	if stored, _ := svc.repo.Get(ctx, "kostas", page.Items[0].ID); stored.Asset != nil || stored.AssetVersion != 0 {
+		t.Fatalf("resolution leaked into the repository: %+v", stored)
+	}
+}
+
+// TestService_Duplicates checks that an asset is a user's favourite at most once, however
+// its JSON is written, unless the duplicate is explicitly allowed.
+func TestService_Duplicates(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	f, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"t","description":"first"}`), nil, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{ "text": "t",  "type": "insight" }`), nil, false)
+	var se *Error
+	if !errors.As(err, &se) || !errors.Is(err, ErrConflict) || se.Code != CodeDuplicateFav || se.ExistingID != f.ID {
+		t.Fatalf("want duplicate of %s, got %#v", f.ID, err)
+	}
+	if _, err := svc.CreateFavourite(ctx, "other", json.RawMessage(`{"type":"insight","text":"t"}`), nil, false); err != nil {
+		t.Fatalf("another user's favourite is not a duplicate: %v", err)
+	}
+	for range 2 {
+		if _, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"t"}`), nil, true); err != nil {
+			t.Fatalf("allowed duplicate: %v", err)
+		}
+	}
+
+	g, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"u"}`), nil, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := svc.ReplaceFavourite(ctx, "kostas", g.ID, json.RawMessage(`{"type":"insight","text":"t"}`), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("replace onto existing content: want ErrConflict, got %v", err)
+	}
+
+	a, err := svc.CreateAsset(ctx, json.RawMessage(`{"type":"insight","text":"t"}`))
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+	res, err := svc.ApplyBatch(ctx, "kostas", []BatchOp{
+		{Op: BatchCreate, AssetID: a.ID},
+		{Op: BatchCreate, AssetID: a.ID},
+		{Op: BatchCreate, AssetID: a.ID, AllowDuplicates: true},
+	}, false)
+	if err != nil || res[0].Err != nil || !errors.Is(res[1].Err, ErrConflict) || res[2].Err != nil {
+		t.Fatalf("batch references = %+v, %v", res, err)
+	}
+}
+
+// TestService_Collections checks manual ordering, listing by position across pages,
+// that deleted favourites leave their collections, and cascading deletes.
+func TestService_Collections(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	var ids []string
+	for _, text := range []string{"a", "b", "c", "d"} {
+		f, err := svc.CreateFavourite(ctx, "kostas", mustRaw(map[string]any{"type": "insight", "text": text}), nil, false)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		ids = append(ids, f.ID)
+	}
+	other, err := svc.CreateFavourite(ctx, "other", json.RawMessage(`{"type":"insight","text":"x"}`), nil, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := svc.CreateCollection(ctx, "kostas", "  ", nil); !errors.Is(err, ErrValidation) {
+		t.Fatalf("blank name: want ErrValidation, got %v", err)
+	}
+	for _, members := range [][]string{{ids[0], ids[0]}, {other.ID}} {
+		if _, err := svc.CreateCollection(ctx, "kostas", "bad", members); !errors.Is(err, ErrValidation) {
+			t.Fatalf("members %v: want ErrValidation, got %v", members, err)
+		}
+	}
+	c, err := svc.CreateCollection(ctx, "kostas", " Reading ", []string{ids[2], ids[0]})
+	if err != nil || c.Name != "Reading" || c.Version != 1 {
+		t.Fatalf("CreateCollection = %+v, %v", c, err)
+	}
+	second, err := svc.CreateCollection(ctx, "kostas", "Later", []string{ids[0]})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+
+	pos := 1
+	if c, err = svc.AddToCollection(ctx, "kostas", c.ID, ids[3], &pos, 0); err != nil {
+		t.Fatalf("AddToCollection: %v", err)
+	}
+	if c, err = svc.AddToCollection(ctx, "kostas", c.ID, ids[1], nil, c.Version); err != nil {
+		t.Fatalf("AddToCollection: %v", err)
+	}
+	if _, err := svc.AddToCollection(ctx, "kostas", c.ID, ids[1], nil, 1); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("stale version: want ErrPrecondition, got %v", err)
+	}
+	if want := []string{ids[2], ids[3], ids[0], ids[1]}; !reflect.DeepEqual(c.FavouriteIDs, want) {
+		t.Fatalf("members = %v, want %v", c.FavouriteIDs, want)
+	}
+
+	var got []string
+	q := repo.ListQuery{Limit: 3, Sort: repo.SortPosition}
+	for {
+		page, err := svc.ListCollectionFavourites(ctx, "kostas", c.ID, q)
+		if err != nil || page.Total != 4 {
+			t.Fatalf("ListCollectionFavourites = %+v, %v", page, err)
+		}
+		for _, f := range page.Items {
+			got = append(got, f.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		q.After = page.Next
+	}
+	if !reflect.DeepEqual(got, c.FavouriteIDs) {
+		t.Fatalf("listed %v, want %v", got, c.FavouriteIDs)
+	}
+	shelf, err := svc.CreateCollection(ctx, "kostas", "shelf", nil)
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	first, _ := svc.ListCollectionFavourites(ctx, "kostas", c.ID, repo.ListQuery{Limit: 1, Sort: repo.SortPosition})
+	if _, err := svc.ListCollectionFavourites(ctx, "kostas", shelf.ID, repo.ListQuery{Sort: repo.SortPosition, After: first.Next}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("cursor of another collection: want ErrValidation, got %v", err)
+	}
+	if _, err := svc.ListFavourites(ctx, "kostas", repo.ListQuery{Sort: repo.SortPosition}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("position sort without collection: want ErrValidation, got %v", err)
+	}
+
+	if err := svc.DeleteFavourite(ctx, "kostas", ids[3], 0); err != nil {
+		t.Fatalf("DeleteFavourite: %v", err)
+	}
+	if c, _ = svc.GetCollection(ctx, "kostas", c.ID); !reflect.DeepEqual(c.FavouriteIDs, []string{ids[2], ids[0], ids[1]}) {
+		t.Fatalf("after delete members = %v", c.FavouriteIDs)
+	}
+
+	before, _ := svc.ListFavourites(ctx, "kostas", repo.ListQuery{})
+	if err := svc.DeleteCollection(ctx, "kostas", c.ID, c.Version-1, true); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("stale cascade delete: want ErrPreconditionFailed, got %v", err)
+	}
+	if page, _ := svc.ListFavourites(ctx, "kostas", repo.ListQuery{}); page.Total != before.Total {
+		t.Fatalf("stale cascade deleted %d favourites", before.Total-page.Total)
+	}
+	if err := svc.DeleteCollection(ctx, "kostas", c.ID, c.Version, true); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	if _, err := svc.GetCollection(ctx, "kostas", c.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted collection: want ErrNotFound, got %v", err)
+	}
+	if page, _ := svc.ListFavourites(ctx, "kostas", repo.ListQuery{}); page.Total != 0 {
+		t.Fatalf("cascade left %d favourites", page.Total)
+	}
+	if second, _ = svc.GetCollection(ctx, "kostas", second.ID); len(second.FavouriteIDs) != 0 {
+		t.Fatalf("cascade left members in other collections: %v", second.FavouriteIDs)
+	}
+}
+
+// TestService_Tags checks tag normalisation, editing, the per-user limit and the counts.
+func TestService_Tags(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	f, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"a"}`), []string{" Q3  Review", "sales", "SALES"}, false)
+	if err != nil || !reflect.DeepEqual(f.Tags, []string{"q3-review", "sales"}) {
+		t.Fatalf("create = %+v, %v", f, err)
+	}
+	_, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"b"}`), []string{"ok", "no/slash", ""}, false)
+	var se *Error
+	if !errors.As(err, &se) || se.Code != CodeInvalidTags || len(se.Fields) != 2 || se.Fields[0].Field != "tags[1]" {
+		t.Fatalf("invalid tags: %#v", err)
+	}
+	tooMany := make([]string, MaxTagsPerFavourite+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("t%d", i)
+	}
+	_, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"b"}`), tooMany, false)
+	if !errors.As(err, &se) || se.Code != CodeLimitExceeded {
+		t.Fatalf("too many tags: want limit_exceeded, got %#v", err)
+	}
+
+	desc := "kept"
+	if f, err = svc.UpdateFavourite(ctx, "kostas", f.ID, &desc, nil, 0); err != nil || !reflect.DeepEqual(f.Tags, []string{"q3-review", "sales"}) {
+		t.Fatalf("description update = %+v, %v", f, err)
+	}
+	if f, err = svc.UpdateFavourite(ctx, "kostas", f.ID, nil, []string{"Sales"}, f.Version); err != nil || !reflect.DeepEqual(f.Tags, []string{"sales"}) || f.Description != "kept" {
+		t.Fatalf("tags update = %+v, %v", f, err)
+	}
+
+	res, err := svc.ApplyBatch(ctx, "kostas", []BatchOp{
+		{Op: BatchCreate, Asset: json.RawMessage(`{"type":"insight","text":"c"}`), Tags: []string{"sales", "q4"}},
+		{Op: BatchPatch, ID: f.ID, Tags: []string{}},
+	}, true)
+	if err != nil || res[1].Favourite.Tags != nil {
+		t.Fatalf("batch = %+v, %v", res, err)
+	}
+	tags, err := svc.ListTags(ctx, "kostas")
+	if err != nil || !reflect.DeepEqual(tags, []models.TagCount{{Tag: "q4", Count: 1}, {Tag: "sales", Count: 1}}) {
+		t.Fatalf("ListTags = %+v, %v", tags, err)
+	}
+
+	// the user's distinct tags are limited; retagging a favourite frees the tags it drops
+	many := make([]string, 0, MaxTagsPerUser)
+	for i := len(tags); i < MaxTagsPerUser; i++ {
+		many = append(many, fmt.Sprintf("t%d", i))
+	}
+	var ops []BatchOp
+	for chunk := range slices.Chunk(many, MaxTagsPerFavourite) {
+		ops = append(ops, BatchOp{Op: BatchCreate, Asset: mustRaw(map[string]any{"type": "insight", "text": chunk[0]}), Tags: chunk})
+	}
+	if _, err := svc.ApplyBatch(ctx, "kostas", ops, true); err != nil {
+		t.Fatalf("fill tags: %v", err)
+	}
+	g, err := svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"d"}`), []string{"one-too-many"}, false)
+	if !errors.As(err, &se) || se.Code != CodeLimitExceeded {
+		t.Fatalf("over the limit: %#v", err)
+	}
+	if g, err = svc.CreateFavourite(ctx, "kostas", json.RawMessage(`{"type":"insight","text":"d"}`), []string{"sales"}, false); err != nil {
+		t.Fatalf("existing tag: %v", err)
+	}
+	if _, err := svc.UpdateFavourite(ctx, "kostas", res[0].Favourite.ID, nil, []string{"replacement"}, 0); err != nil {
+		t.Fatalf("retag within the limit: %v", err)
+	}
+	if page, err := svc.ListFavourites(ctx, "kostas", repo.ListQuery{Tags: []string{"sales"}}); err != nil || page.Total != 1 || page.Items[0].ID != g.ID {
+		t.Fatalf("tag filter = %+v, %v", page, err)
+	}
+	// a batch patch frees the tags it drops too, also when patching the same favourite twice
+	if _, err := svc.ApplyBatch(ctx, "kostas", []BatchOp{
+		{Op: BatchPatch, ID: res[0].Favourite.ID, Tags: []string{"batch-1"}},
+		{Op: BatchPatch, ID: res[0].Favourite.ID, Tags: []string{"batch-2"}},
+	}, true); err != nil {
+		t.Fatalf("batch retag within the limit: %v", err)
+	}
+}
+
+// TestService_TagLimitUnderConcurrency checks that concurrent writes cannot take the
+// user past MaxTagsPerUser together.
+func TestService_TagLimitUnderConcurrency(t *testing.T) {
+	svc := NewService(repo.NewInMemoryRepo())
+	ctx := context.Background()
+
+	var ops []BatchOp
+	for i := 0; i < MaxTagsPerUser-1; i += MaxTagsPerFavourite {
+		var chunk []string
+		for j := i; j < min(i+MaxTagsPerFavourite, MaxTagsPerUser-1); j++ {
+			chunk = append(chunk, fmt.Sprintf("t%d", j))
+		}
+		ops = append(ops, BatchOp{Op: BatchCreate, Asset: mustRaw(map[string]any{"type": "insight", "text": chunk[0]}), Tags: chunk})
+	}
+	if _, err := svc.ApplyBatch(ctx, "kostas", ops, true); err != nil {
+		t.Fatalf("fill tags: %v", err)
+	}
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.CreateFavourite(ctx, "kostas", mustRaw(map[string]any{"type": "insight", "text": fmt.Sprintf("w%d", i)}), []string{fmt.Sprintf("new-%d", i)}, false)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	ok := 0
+	for err := range errs {
+		var se *Error
+		switch {
+		case err == nil:
+			ok++
+		case !errors.As(err, &se) || se.Code != CodeLimitExceeded:
+			t.Fatalf("want limit_exceeded, got %v", err)
+		}
+	}
+	if tags, _ := svc.ListTags(ctx, "kostas"); ok != 1 || len(tags) != MaxTagsPerUser {
+		t.Fatalf("%d writers succeeded, user has %d tags", ok, len(tags))
 	}
 }
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KostasDasios/platform-go-challenge/internal/models"
+)
+
+// Limits on tags.
+const (
+	MaxTagsPerFavourite = 20
+	MaxTagsPerUser      = 500 // distinct tags across the user's favourites
+	MaxTagLen           = 50  // characters
+)
+
+// NormalizeTag returns the canonical form of a tag: lower-cased, with each run of white
+// space inside it turned into one hyphen, so "Q3  Review" becomes "q3-review". ok is
+// false unless the result has 1-MaxTagLen letters, digits, '-', '_' or '.'.
+func NormalizeTag(tag string) (_ string, ok bool) {
+	tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLen {
+		return tag, false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r) {
+			return tag, false
+		}
+	}
+	return tag, true
+}
+
+// normalizeTags normalises a favourite's tags and returns them sorted, without repeats.
+// nil stays nil (tags left alone); any other input yields a non-nil slice, so an empty
+// list clears a favourite's tags.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	out := make([]string, 0, len(tags))
+	var fields []FieldError
+	for i, t := range tags {
+		n, ok := NormalizeTag(t)
+		if !ok {
+			fields = append(fields, FieldError{fmt.Sprintf("tags[%d]", i),
+				fmt.Sprintf("must be 1-%d letters, digits, '-', '_' or '.'", MaxTagLen)})
+			continue
+		}
+		out = append(out, n)
+	}
+	if fields != nil {
+		return nil, validationError(CodeInvalidTags, "invalid tags", fields...)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > MaxTagsPerFavourite {
+		return nil, limitExceeded("tags", MaxTagsPerFavourite, "tags per favourite")
+	}
+	return out, nil
+}
+
+// tagBudget enforces MaxTagsPerUser while a request tags favourites: it starts from the
+// user's stored tag counts and records the tags of every favourite it admits. Callers
+// hold the user's tag lock from loading the budget until the favourites are written.
+type tagBudget struct {
+	counts map[string]int
+	tags   map[string][]string // favID -> tags given by the operations admitted so far
+}
+
+// tagBudget loads the user's tag counts.
+func (s *Service) tagBudget(ctx context.Context, userID string) (*tagBudget, error) {
+	counts, err := s.repo.TagCounts(ctx, userID)
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	return &tagBudget{counts: counts, tags: make(map[string][]string)}, nil
+}
+
+// take accounts for a favourite whose tags change from replaced to tags. It fails if
+// the user would end up with more than MaxTagsPerUser distinct tags.
+func (b *tagBudget) take(tags, replaced []string) error {
+	distinct := len(b.counts)
+	for _, t := range replaced {
+		if b.counts[t] == 1 && !slices.Contains(tags, t) {
+			distinct--
+		}
+	}
+	for _, t := range tags {
+		if b.counts[t] == 0 {
+			distinct++
+		}
+	}
+	if distinct > MaxTagsPerUser {
+		return limitExceeded("tags", MaxTagsPerUser, "distinct tags per user")
+	}
+	for _, t := range replaced {
+		if b.counts[t]--; b.counts[t] <= 0 {
+			delete(b.counts, t)
+		}
+	}
+	for _, t := range tags {
+		b.counts[t]++
+	}
+	return nil
+}
+
+// admit normalises the tags of a batch operation on the favourite favID, currently
+// tagged with stored, and takes them from the budget. An earlier operation of the batch
+// on the same favourite takes precedence over stored. b may be nil when tags is empty.
+func (b *tagBudget) admit(favID string, tags, stored []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil || len(tags) == 0 {
+		return tags, err
+	}
+	replaced, ok := b.tags[favID]
+	if !ok {
+		replaced = stored
+	}
+	if err := b.take(tags, replaced); err != nil {
+		return nil, err
+	}
+	b.tags[favID] = tags
+	return tags, nil
+}
+
+// checkTags normalises the tags of one of the user's favourites, currently tagged with
+// replaced, and checks them against the per-user limit. Callers hold the user's tag lock.
+func (s *Service) checkTags(ctx context.Context, userID string, tags, replaced []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil || len(tags) == 0 {
+		return tags, err
+	}
+	b, err := s.tagBudget(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return tags, b.take(tags, replaced)
+}
+
+// userLocks hands out one mutex per user. They serialise the writes that add tags, so
+// that checking MaxTagsPerUser and storing the favourites happen as one step; the limit
+// therefore holds per process, which matches the single-node storage backends.
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockTags locks the user's tags when tags adds any and returns the unlock function.
+// Locks are dropped once nobody holds or waits for them.
+func (l *userLocks) lockTags(userID string, tags []string) (unlock func()) {
+	if len(tags) == 0 {
+		return func() {}
+	}
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*userLock)
+	}
+	ul := l.locks[userID]
+	if ul == nil {
+		ul = &userLock{}
+		l.locks[userID] = ul
+	}
+	ul.refs++
+	l.mu.Unlock()
+
+	ul.Lock()
+	return func() {
+		ul.Unlock()
+		l.mu.Lock()
+		if ul.refs--; ul.refs == 0 {
+			delete(l.locks, userID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// ListTags returns the user's tags with the number of favourites carrying each, most
+// used first and then alphabetically.
+func (s *Service) ListTags(ctx context.Context, userID string) (_ []models.TagCount, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListTags")
+	defer func() { endSpan(span, err) }()
+	if !s.ValidateUserID(userID) {
+		return nil, invalidUserID()
+	}
+	counts, err := s.repo.TagCounts(ctx, userID)
+	if err != nil {
+		return nil, fromRepo(err)
+	}
+	out := make([]models.TagCount, 0, len(counts))
+	for tag, n := range counts {
+		out = append(out, models.TagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Tag < out[j].Tag
+	})
+	return out, nil
+}